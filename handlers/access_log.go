@@ -0,0 +1,273 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CommonLogFormat is the Apache/NCSA Common Log Format
+	CommonLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+	// CombinedLogFormat is the Apache/NCSA Combined Log Format, which is also the nginx default
+	CombinedLogFormat = CommonLogFormat + ` "$http_referer" "$http_user_agent"`
+)
+
+// accessLogEntry is the information about a request available to an access log variable
+type accessLogEntry struct {
+	w      LoggingResponseWriter
+	req    *http.Request
+	url    url.URL
+	ts     time.Time
+	dur    time.Duration
+	status int
+	size   int
+}
+
+// accessLogVariable returns the value of a variable for an entry
+type accessLogVariable func(e accessLogEntry) string
+
+// accessLogVariables are the supported nginx log_format variables
+var accessLogVariables = map[string]accessLogVariable{
+	"remote_addr": func(e accessLogEntry) string {
+		if ip, err := getUserIP(e.req); err == nil {
+			return ip.String()
+		}
+		return ""
+	},
+	"remote_user": func(e accessLogEntry) string {
+		if e.url.User != nil {
+			return e.url.User.Username()
+		}
+		user, _, _ := e.req.BasicAuth()
+		return user
+	},
+	"time_local":   func(e accessLogEntry) string { return e.ts.Format("02/Jan/2006:15:04:05 -0700") },
+	"time_iso8601": func(e accessLogEntry) string { return e.ts.Format(time.RFC3339) },
+	"msec": func(e accessLogEntry) string {
+		return fmt.Sprintf("%.3f", float64(e.ts.UnixNano())/float64(time.Second))
+	},
+	"request":         func(e accessLogEntry) string { return e.req.Method + " " + parseURI(e.req, e.url) + " " + e.req.Proto },
+	"request_method":  func(e accessLogEntry) string { return e.req.Method },
+	"request_uri":     func(e accessLogEntry) string { return parseURI(e.req, e.url) },
+	"uri":             func(e accessLogEntry) string { return uriPath(e.req, e.url) },
+	"args":            func(e accessLogEntry) string { return e.url.RawQuery },
+	"query_string":    func(e accessLogEntry) string { return e.url.RawQuery },
+	"server_protocol": func(e accessLogEntry) string { return e.req.Proto },
+	"host":            func(e accessLogEntry) string { return e.req.Host },
+	"status":          func(e accessLogEntry) string { return strconv.Itoa(e.status) },
+	"body_bytes_sent": func(e accessLogEntry) string { return strconv.Itoa(e.size) },
+	"request_time":    func(e accessLogEntry) string { return fmt.Sprintf("%.3f", e.dur.Seconds()) },
+	"request_length": func(e accessLogEntry) string {
+		if e.req.ContentLength < 0 {
+			return ""
+		}
+		return strconv.FormatInt(e.req.ContentLength, 10)
+	},
+	"request_id": func(e accessLogEntry) string { return GetRequestID(e.req) },
+}
+
+// AccessLogFormat is a compiled nginx log_format style template
+//
+// Variables are written as $name or ${name}. The supported variables are:
+//  $remote_addr        - the client ip (see ClientIPResolver)
+//  $remote_user        - the basic auth user name
+//  $time_local         - 28/Oct/2016:10:51:32 +0000
+//  $time_iso8601       - 2016-10-28T10:51:32Z
+//  $msec               - unix time in seconds with millisecond resolution
+//  $request            - GET /path?query HTTP/1.1
+//  $request_method     - GET
+//  $request_uri        - /path?query
+//  $uri                - /path
+//  $args, $query_string - query
+//  $server_protocol    - HTTP/1.1
+//  $host               - the Host header
+//  $status             - the response status
+//  $body_bytes_sent    - the size of the response body
+//  $request_time       - the time taken in seconds with millisecond resolution
+//  $request_length     - the size of the request body, if known
+//  $request_id         - the request id (see RequestIDHandler)
+//  $http_<name>        - a request header, e.g. $http_user_agent for User-Agent
+//  $sent_http_<name>   - a response header, e.g. $sent_http_content_type for Content-Type
+//
+// As with nginx, empty values are written as - and double quotes, backslashes and control characters are escaped as
+// \xHH
+type AccessLogFormat struct {
+	parts []accessLogPart
+}
+
+// accessLogPart is either literal text or a variable
+type accessLogPart struct {
+	text     string
+	variable accessLogVariable
+}
+
+// NewAccessLogFormat compiles an nginx log_format style template, returning an error for unknown variables
+//
+// Usage:
+//  format, err := handlers.NewAccessLogFormat(`$remote_addr [$time_local] "$request" $status $request_time`)
+func NewAccessLogFormat(format string) (*AccessLogFormat, error) {
+	f := &AccessLogFormat{}
+	text := ""
+	for i := 0; i < len(format); i++ {
+		if format[i] != '$' {
+			text += format[i : i+1]
+			continue
+		}
+
+		name, end := "", i+1
+		if end < len(format) && format[end] == '{' {
+			close := strings.IndexByte(format[end:], '}')
+			if close < 0 {
+				return nil, fmt.Errorf("access log format: unclosed variable at %d in: %s", i, format)
+			}
+			name, end = format[end+1:end+close], end+close+1
+		} else {
+			for end < len(format) && isVariableChar(format[end]) {
+				end++
+			}
+			name = format[i+1 : end]
+		}
+		if name == "" {
+			text += "$"
+			continue
+		}
+
+		variable, err := lookupAccessLogVariable(name)
+		if err != nil {
+			return nil, err
+		}
+		if text != "" {
+			f.parts = append(f.parts, accessLogPart{text: text})
+			text = ""
+		}
+		f.parts = append(f.parts, accessLogPart{variable: variable})
+		i = end - 1
+	}
+	if text != "" {
+		f.parts = append(f.parts, accessLogPart{text: text})
+	}
+	return f, nil
+}
+
+// isVariableChar returns true if c can be part of a variable name
+func isVariableChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// lookupAccessLogVariable returns the variable called name
+func lookupAccessLogVariable(name string) (accessLogVariable, error) {
+	if variable, ok := accessLogVariables[name]; ok {
+		return variable, nil
+	}
+	if strings.HasPrefix(name, "http_") && len(name) > 5 {
+		header := http.CanonicalHeaderKey(strings.Replace(name[5:], "_", "-", -1))
+		return func(e accessLogEntry) string { return e.req.Header.Get(header) }, nil
+	}
+	if strings.HasPrefix(name, "sent_http_") && len(name) > 10 {
+		header := http.CanonicalHeaderKey(strings.Replace(name[10:], "_", "-", -1))
+		return func(e accessLogEntry) string { return e.w.Header().Get(header) }, nil
+	}
+	return nil, fmt.Errorf("access log format: unknown variable $%s", name)
+}
+
+// Format returns the log line for a request, without a trailing new line
+//
+// It takes the same arguments as the function passed to LogServeHTTP
+func (f *AccessLogFormat) Format(w LoggingResponseWriter, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) string {
+	e := accessLogEntry{w, req, url, ts, dur, status, size}
+	buf := &bytes.Buffer{}
+	for _, part := range f.parts {
+		if part.variable == nil {
+			buf.WriteString(part.text)
+			continue
+		}
+		value := part.variable(e)
+		if value == "" {
+			buf.WriteByte('-')
+			continue
+		}
+		escapeAccessLog(buf, value)
+	}
+	return buf.String()
+}
+
+// escapeAccessLog writes value to buf with double quotes, backslashes and non printable characters escaped as \xHH
+func escapeAccessLog(buf *bytes.Buffer, value string) {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			fmt.Fprintf(buf, `\x%02X`, c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+}
+
+type accessLogHandler struct {
+	writer  io.Writer
+	format  *AccessLogFormat
+	handler http.Handler
+}
+
+// ServeHTTP does the actual handling of HTTP requests by wrapping the request in a logger
+func (h accessLogHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	LogServeHTTP(w, req, h.handler, h.writeLog)
+}
+
+// writeLog writes a line in the access log format to accessLogHandler's writer
+func (h accessLogHandler) writeLog(w LoggingResponseWriter, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
+	io.WriteString(h.writer, h.format.Format(w, req, url, ts, dur, status, size)+"\n")
+}
+
+// AccessLogHandler returns a http.Handler that wraps h and logs each request to out using format
+//
+// Usage:
+//  format, err := handlers.NewAccessLogFormat(`$remote_addr "$request" $status $body_bytes_sent $request_time`)
+//  if err != nil {
+//      panic(err)
+//  }
+//  loggedRouter := handlers.AccessLogHandler(os.Stdout, format, r)
+func AccessLogHandler(out io.Writer, format *AccessLogFormat, h http.Handler) http.Handler {
+	return accessLogHandler{out, format, h}
+}
+
+var (
+	commonLogFormat, _   = NewAccessLogFormat(CommonLogFormat)
+	combinedLogFormat, _ = NewAccessLogFormat(CombinedLogFormat)
+)
+
+// CommonLogHandler returns a http.Handler that wraps h and logs each request to out in the Apache Common Log Format
+//
+// Example output:
+//  127.0.0.1 - frank [10/Oct/2000:13:55:36 +0000] "GET /apache_pb.gif HTTP/1.0" 200 2326
+func CommonLogHandler(out io.Writer, h http.Handler) http.Handler {
+	return AccessLogHandler(out, commonLogFormat, h)
+}
+
+// CombinedLogHandler returns a http.Handler that wraps h and logs each request to out in the Apache Combined Log Format
+//
+// Example output:
+//  127.0.0.1 - frank [10/Oct/2000:13:55:36 +0000] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"
+//
+// Usage:
+//  loggedRouter := handlers.CombinedLogHandler(os.Stdout, r)
+//  http.ListenAndServe(":1123", loggedRouter)
+func CombinedLogHandler(out io.Writer, h http.Handler) http.Handler {
+	return AccessLogHandler(out, combinedLogFormat, h)
+}
@@ -0,0 +1,149 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/graze/golang-service/log"
+	"github.com/graze/golang-service/metrics"
+)
+
+// AllConf describes which handlers are applied by AllHandlersWith and how they are configured
+type AllConf struct {
+	// Logger is used for the logging context and structured request log. Defaults to the global logger
+	Logger log.FieldLogger
+	// RequestID adds the RequestIDHandler
+	RequestID bool
+	// Trace adds the TraceHandler
+	Trace bool
+	// Context adds the LoggingContextHandler
+	Context bool
+	// Structured adds the StructuredLogHandler
+	Structured bool
+	// Statsd adds the statsd handler using StatsdConf and StatsdClientOptions
+	Statsd              bool
+	StatsdConf          metrics.StatsdClientConf
+	StatsdClientOptions metrics.ClientOptions
+	// StatsdOptions configure the metrics sent by the statsd handler, if set
+	StatsdOptions *StatsdOptions
+	// StructuredOptions configure the entries logged by the structured log handler, if set
+	StructuredOptions *StructuredOptions
+	// Healthd adds the healthd handler writing to HealthdDir
+	Healthd    bool
+	HealthdDir string
+	// Paths normalises the endpoint reported by the statsd and structured log handlers, if set and the options do not
+	// set their own
+	Paths *PathNormaliser
+}
+
+// AllConfFromEnv creates an AllConf from environment variables
+//
+// Environment Variables:
+//  HANDLERS_REQUEST_ID: enable the request id handler (default: true)
+//  HANDLERS_TRACE: enable the W3C trace context handler (default: true)
+//  HANDLERS_CONTEXT: enable the logging context handler (default: true)
+//  HANDLERS_STRUCTURED: enable the structured request log handler (default: true)
+//  HANDLERS_STATSD: enable the statsd handler (default: true if STATSD_HOST or DD_AGENT_HOST is set)
+//  HANDLERS_HEALTHD: enable the healthd handler (default: false)
+//  HANDLERS_HEALTHD_DIR: the directory to write healthd logs to (default: /var/log/nginx/healthd/)
+//  STATSD_*: the statsd configuration, see metrics.LoadStatsdConf and metrics.LoadClientOptions
+func AllConfFromEnv() AllConf {
+	return AllConf{
+		RequestID:           envBool("HANDLERS_REQUEST_ID", true),
+		Trace:               envBool("HANDLERS_TRACE", true),
+		Context:             envBool("HANDLERS_CONTEXT", true),
+		Structured:          envBool("HANDLERS_STRUCTURED", true),
+		Statsd:              envBool("HANDLERS_STATSD", os.Getenv("STATSD_HOST") != "" || os.Getenv("DD_AGENT_HOST") != ""),
+		StatsdConf:          metrics.StatsdConfFromEnv(),
+		StatsdClientOptions: metrics.ClientOptionsFromEnv(),
+		Healthd:             envBool("HANDLERS_HEALTHD", false),
+		HealthdDir:          os.Getenv("HANDLERS_HEALTHD_DIR"),
+	}
+}
+
+// envBool returns the boolean value of the environment variable name, or def if it is not set or invalid
+func envBool(name string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// AllHandlersWith wraps h with each handler enabled in conf
+//
+// The handlers are applied in the following order (outermost first):
+//  RequestIDHandler - so the request id is used as the logging context's transaction
+//  TraceHandler
+//  LoggingContextHandler - so every other handler and h can use the request's logging context
+//  StructuredLogHandler
+//  statsd
+//  HealthdHandler
+func AllHandlersWith(conf AllConf, h http.Handler) http.Handler {
+	logger := conf.Logger
+	if logger == nil {
+		logger = log.With(log.KV{})
+	}
+
+	if conf.Healthd {
+		dir := conf.HealthdDir
+		if dir == "" {
+			dir = DefaultHealthdDir
+		}
+		h = HealthdDirHandler(dir, h)
+	}
+	if conf.Statsd {
+		options := StatsdOptions{}
+		if conf.StatsdOptions != nil {
+			options = *conf.StatsdOptions
+		}
+		if options.Paths == nil {
+			options.Paths = conf.Paths
+		}
+		h = newStatsdHandler(conf.StatsdConf, conf.StatsdClientOptions, options)(h)
+	}
+	if conf.Structured {
+		options := StructuredOptions{}
+		if conf.StructuredOptions != nil {
+			options = *conf.StructuredOptions
+		}
+		if options.Paths == nil {
+			options.Paths = conf.Paths
+		}
+		h = StructuredLogHandlerWithOptions(logger.With(log.KV{"module": "request.handler"}), options, h)
+	}
+	if conf.Context {
+		h = LoggingContextHandler(logger, h)
+	}
+	if conf.Trace {
+		h = TraceHandler(h)
+	}
+	if conf.RequestID {
+		h = RequestIDHandler(h)
+	}
+	return h
+}
+
+// AllHandlers wraps h with all the handlers configured through environment variables (see AllConfFromEnv)
+//
+// Usage:
+//  r := mux.NewRouter()
+//  r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//  	w.Write([]byte("This is a catch-all route"))
+//  })
+//  loggedRouter := handlers.AllHandlers(r)
+//  http.ListenAndServe(":1123", loggedRouter)
+func AllHandlers(h http.Handler) http.Handler {
+	return AllHandlersWith(AllConfFromEnv(), h)
+}
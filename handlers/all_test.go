@@ -0,0 +1,141 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/graze/golang-service/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllConfFromEnv(t *testing.T) {
+	cases := map[string]struct {
+		env      map[string]string
+		expected AllConf
+	}{
+		"defaults": {
+			map[string]string{},
+			AllConf{RequestID: true, Trace: true, Context: true, Structured: true},
+		},
+		"statsd host enables statsd": {
+			map[string]string{"STATSD_HOST": "localhost", "STATSD_PORT": "8125"},
+			AllConf{RequestID: true, Trace: true, Context: true, Structured: true, Statsd: true},
+		},
+		"disable everything": {
+			map[string]string{
+				"HANDLERS_REQUEST_ID": "false",
+				"HANDLERS_TRACE":      "false",
+				"HANDLERS_CONTEXT":    "false",
+				"HANDLERS_STRUCTURED": "0",
+				"HANDLERS_STATSD":     "false",
+				"HANDLERS_HEALTHD":    "false",
+				"STATSD_HOST":         "localhost",
+			},
+			AllConf{},
+		},
+		"invalid values use the defaults": {
+			map[string]string{"HANDLERS_CONTEXT": "nope", "HANDLERS_HEALTHD": "yes please"},
+			AllConf{RequestID: true, Trace: true, Context: true, Structured: true},
+		},
+		"enable healthd": {
+			map[string]string{"HANDLERS_HEALTHD": "true", "HANDLERS_HEALTHD_DIR": "/tmp/healthd/"},
+			AllConf{RequestID: true, Trace: true, Context: true, Structured: true, Healthd: true, HealthdDir: "/tmp/healthd/"},
+		},
+	}
+
+	for k, tc := range cases {
+		for name, value := range tc.env {
+			os.Setenv(name, value)
+		}
+		conf := AllConfFromEnv()
+		assert.Equal(t, tc.expected.RequestID, conf.RequestID, "test: %s - RequestID", k)
+		assert.Equal(t, tc.expected.Trace, conf.Trace, "test: %s - Trace", k)
+		assert.Equal(t, tc.expected.Context, conf.Context, "test: %s - Context", k)
+		assert.Equal(t, tc.expected.Structured, conf.Structured, "test: %s - Structured", k)
+		assert.Equal(t, tc.expected.Statsd, conf.Statsd, "test: %s - Statsd", k)
+		assert.Equal(t, tc.expected.Healthd, conf.Healthd, "test: %s - Healthd", k)
+		assert.Equal(t, tc.expected.HealthdDir, conf.HealthdDir, "test: %s - HealthdDir", k)
+		for name := range tc.env {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestAllHandlersWithAppliesTheContextBeforeTheStructuredLog(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, log.Ctx(r.Context()).Fields(), "transaction")
+		w.Write([]byte("ok\n"))
+	})
+
+	handler := AllHandlersWith(AllConf{Logger: logger, Context: true, Structured: true}, h)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "http://example.com/path"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, len(hook.Entries))
+	assert.Equal(t, "request_handled", hook.LastEntry().Data["tag"])
+	assert.Equal(t, "request.handler", hook.LastEntry().Data["module"])
+	assert.Contains(t, hook.LastEntry().Data, "transaction")
+}
+
+func TestAllHandlersWithNothingEnabledReturnsTheHandler(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	handler := AllHandlersWith(AllConf{Logger: logger}, okHandler)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "http://example.com/path"))
+
+	assert.Equal(t, "ok\n", rec.Body.String())
+	assert.Equal(t, 0, len(hook.Entries))
+}
+
+func TestAllHandlersWithUsesTheRequestIDAsTheTransaction(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	handler := AllHandlersWith(AllConf{Logger: logger, RequestID: true, Trace: true, Context: true, Structured: true}, okHandler)
+	req := newRequest("GET", "http://example.com/path")
+	req.Header.Set(RequestIDHeader, "upstream-id")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "upstream-id", rec.Header().Get(RequestIDHeader))
+	assert.Equal(t, "upstream-id", hook.LastEntry().Data["transaction"])
+	assert.Contains(t, hook.LastEntry().Data, "trace.id")
+}
+
+func TestAllHandlersWithPassesTheStructuredOptions(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	handler := AllHandlersWith(AllConf{
+		Logger:            logger,
+		Structured:        true,
+		StructuredOptions: &StructuredOptions{Exclude: []string{"/health"}},
+		Paths:             NewPathNormaliser(),
+	}, okHandler)
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/health"))
+	assert.Equal(t, 0, len(hook.Entries), "excluded paths are not logged")
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/users/12"))
+	assert.Equal(t, 1, len(hook.Entries))
+	assert.Equal(t, "/users/{id}", hook.LastEntry().Data["http.endpoint"], "the paths are used when the options do not set them")
+}
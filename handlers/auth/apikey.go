@@ -37,10 +37,16 @@ type (
 	// NoHeaderError for when the Authorization header is not provided
 	NoHeaderError struct{}
 	// InvalidFormatError if the Authorization header is not in the format: <provider> <apiKey>
+	//
+	// The credentials in the supplied header are redacted using Redact
 	InvalidFormatError struct{ format, header string }
 	// BadProviderError when the supplied provider does not match the expected
+	//
+	// The supplied provider is redacted using Redact, as it is the key itself when a header has no scheme
 	BadProviderError struct{ provider, expected string }
 	// InvalidKeyError if the supplied key does not match any existing keys
+	//
+	// The supplied key is redacted using Redact
 	InvalidKeyError struct {
 		key string
 		err error
@@ -52,15 +58,20 @@ func (e *NoHeaderError) Error() string {
 }
 
 func (e *InvalidFormatError) Error() string {
-	return fmt.Sprintf("provided Authorization header in invalid format, expecting: %s got: %s", e.format, e.header)
+	return fmt.Sprintf("provided Authorization header in invalid format, expecting: %s got: %s", e.format, redactHeader(e.header))
 }
 
 func (e *BadProviderError) Error() string {
-	return fmt.Sprintf("Authroziation provider does not match. Expecting: %s got: %s", e.expected, e.provider)
+	return fmt.Sprintf("Authroziation provider does not match. Expecting: %s got: %s", e.expected, Redact(e.provider))
 }
 
 func (e *InvalidKeyError) Error() string {
-	return fmt.Sprintf("provided api key: '%s' is not valid: %s", e.key, e.err.Error())
+	reason := e.err.Error()
+	if e.key != "" {
+		// Finders can include the key in their errors
+		reason = strings.Replace(reason, e.key, Redact(e.key), -1)
+	}
+	return fmt.Sprintf("provided api key: '%s' is not valid: %s", Redact(e.key), reason)
 }
 
 // ThenFunc surrounds an existing handler func and returns a new http.Handler
@@ -73,7 +84,7 @@ func (e *InvalidKeyError) Error() string {
 // 		}
 // 		user, ok := users[key]
 // 		if !ok {
-// 			return nil, fmt.Errorf("No user found for: %s", key)
+// 			return nil, fmt.Errorf("No user found")
 // 		}
 // 		return user, nil
 // 	}
@@ -100,7 +111,7 @@ func (a *APIKey) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Hand
 // 		}
 // 		user, ok := users[key]
 // 		if !ok {
-// 			return nil, fmt.Errorf("No user found for: %s", key)
+// 			return nil, fmt.Errorf("No user found")
 // 		}
 // 		return user, nil
 // 	}
@@ -119,34 +130,40 @@ func (a *APIKey) Then(h http.Handler) http.Handler {
 
 // Handler wraps the Then method to become clearer
 func (a *APIKey) Handler(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		header := req.Header["Authorization"]
-		if len(header) == 0 {
-			a.OnError.Handle(w, req, &NoHeaderError{}, http.StatusUnauthorized)
-			return
-		}
-
-		parts := strings.Split(header[0], " ")
-		if len(parts) != 2 {
-			a.OnError.Handle(w, req, &InvalidFormatError{"<provider> <apiKey>", header[0]}, http.StatusUnauthorized)
-			return
-		}
-
-		provider, value := parts[0], parts[1]
-		if provider != a.Provider {
-			a.OnError.Handle(w, req, &BadProviderError{provider, a.Provider}, http.StatusUnauthorized)
-			return
-		}
-
-		user, err := a.Finder.Find(value, req)
-		if err != nil {
-			a.OnError.Handle(w, req, &InvalidKeyError{value, err}, http.StatusUnauthorized)
-			return
-		}
-		req = saveUser(req, user)
-
-		h.ServeHTTP(w, req)
-	})
+	return authHandler(a, a.OnError, h)
+}
+
+// Authenticate checks the Authorization header of req and returns the user found by the Finder
+func (a *APIKey) Authenticate(req *http.Request) (interface{}, error) {
+	header := req.Header["Authorization"]
+	if len(header) == 0 {
+		return nil, &NoHeaderError{}
+	}
+
+	parts := strings.Split(header[0], " ")
+	if len(parts) != 2 {
+		return nil, &InvalidFormatError{"<provider> <apiKey>", header[0]}
+	}
+
+	provider, value := parts[0], parts[1]
+	if provider != a.Provider {
+		return nil, &BadProviderError{provider, a.Provider}
+	}
+
+	user, err := a.Finder.Find(value, req)
+	if err != nil {
+		return nil, &InvalidKeyError{value, err}
+	}
+	return user, nil
+}
+
+// suppliedKey returns the api key in the Authorization header of req, or "" if there is none
+func (a *APIKey) suppliedKey(req *http.Request) string {
+	parts := strings.Split(req.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != a.Provider {
+		return ""
+	}
+	return parts[1]
 }
 
 // NewAPIKey returns an APIKey struct that has a Handle method to provide authentication to your service
@@ -0,0 +1,81 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/graze/golang-service/handlers/failure"
+)
+
+// Authenticator checks the credentials supplied with a request and returns the user they belong to
+//
+// APIKey, XAPIKey, Basic, JWT and HMAC are all Authenticators
+type Authenticator interface {
+	Authenticate(req *http.Request) (interface{}, error)
+}
+
+// challenger is implemented by Authenticators that send a WWW-Authenticate challenge when authentication fails
+type challenger interface {
+	Challenge() string
+}
+
+// IsMissingCredentials returns true if err means no credentials were supplied for an authentication scheme,
+// as opposed to credentials being supplied and being invalid
+func IsMissingCredentials(err error) bool {
+	switch err.(type) {
+	case *NoHeaderError, *BadProviderError:
+		return true
+	}
+	return false
+}
+
+// authHandler returns a http.Handler that authenticates each request using a and saves the user to the request
+// context before calling h, or calls onError with http.StatusUnauthorized if authentication fails
+func authHandler(a Authenticator, onError failure.Handler, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, err := a.Authenticate(req)
+		if err != nil {
+			challenge(w, a)
+			onError.Handle(w, req, err, failureStatus(w, err))
+			return
+		}
+		req = saveUser(req, user)
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// challenge adds the WWW-Authenticate challenge of a to the response if it has one
+func challenge(w http.ResponseWriter, a Authenticator) {
+	if c, ok := a.(challenger); ok && c.Challenge() != "" {
+		w.Header().Set("WWW-Authenticate", c.Challenge())
+	}
+}
+
+// failureStatus returns the http status for an authentication error
+//
+// Locked out clients get http.StatusTooManyRequests with a Retry-After header, bodies too large to verify get
+// http.StatusRequestEntityTooLarge and everything else is http.StatusUnauthorized
+func failureStatus(w http.ResponseWriter, err error) int {
+	if _, ok := err.(*BodyTooLargeError); ok {
+		return http.StatusRequestEntityTooLarge
+	}
+	if e, ok := err.(*LockedOutError); ok {
+		seconds := math.Ceil(e.until.Sub(time.Now()).Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(seconds, 1))))
+		return http.StatusTooManyRequests
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,172 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/graze/golang-service/handlers/failure"
+)
+
+// Policy decides if a user is allowed to make a request
+type Policy interface {
+	// Authorize returns nil if user is allowed to make the request r, or an error (usually a *ForbiddenError) if not
+	Authorize(user interface{}, r *http.Request) error
+}
+
+// PolicyFunc converts a predicate over the user and request into a Policy
+type PolicyFunc func(user interface{}, r *http.Request) bool
+
+// Authorize returns a *ForbiddenError if the predicate returns false
+func (f PolicyFunc) Authorize(user interface{}, r *http.Request) error {
+	if !f(user, r) {
+		return &ForbiddenError{"access denied"}
+	}
+	return nil
+}
+
+// RoleHolder is implemented by users that have roles and can be used with RequireRole
+type RoleHolder interface {
+	HasRole(role string) bool
+}
+
+// ScopeHolder is implemented by users that have scopes and can be used with RequireScopes
+type ScopeHolder interface {
+	HasScope(scope string) bool
+}
+
+// ForbiddenError if the authenticated user is not allowed to make the request
+type ForbiddenError struct{ reason string }
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("user is not allowed to access this resource: %s", e.reason)
+}
+
+type (
+	rolePolicy  []string
+	scopePolicy []string
+	allPolicy   []Policy
+	anyPolicy   []Policy
+)
+
+// RequireRole creates a Policy that allows users implementing RoleHolder that have any of the supplied roles
+func RequireRole(roles ...string) Policy {
+	return rolePolicy(roles)
+}
+
+func (p rolePolicy) Authorize(user interface{}, r *http.Request) error {
+	if holder, ok := user.(RoleHolder); ok {
+		for _, role := range p {
+			if holder.HasRole(role) {
+				return nil
+			}
+		}
+	}
+	return &ForbiddenError{"requires one of the roles: " + strings.Join(p, ", ")}
+}
+
+// RequireScopes creates a Policy that allows users implementing ScopeHolder that have all of the supplied scopes
+func RequireScopes(scopes ...string) Policy {
+	return scopePolicy(scopes)
+}
+
+func (p scopePolicy) Authorize(user interface{}, r *http.Request) error {
+	holder, ok := user.(ScopeHolder)
+	if ok {
+		for _, scope := range p {
+			if !holder.HasScope(scope) {
+				ok = false
+				break
+			}
+		}
+	}
+	if !ok {
+		return &ForbiddenError{"requires the scopes: " + strings.Join(p, ", ")}
+	}
+	return nil
+}
+
+// RequireAll creates a Policy that requires every one of the supplied policies to allow the request
+func RequireAll(policies ...Policy) Policy {
+	return allPolicy(policies)
+}
+
+func (p allPolicy) Authorize(user interface{}, r *http.Request) error {
+	for _, policy := range p {
+		if err := policy.Authorize(user, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequireAny creates a Policy that requires at least one of the supplied policies to allow the request
+func RequireAny(policies ...Policy) Policy {
+	return anyPolicy(policies)
+}
+
+func (p anyPolicy) Authorize(user interface{}, r *http.Request) (err error) {
+	err = &ForbiddenError{"no policies supplied"}
+	for _, policy := range p {
+		if err = policy.Authorize(user, r); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Authorizer checks the user stored in the request by an authenticator against a Policy
+type Authorizer struct {
+	// Policy decides if the user is allowed to make the request
+	Policy Policy
+	// OnError gets called with http.StatusForbidden if the request is not allowed
+	OnError failure.Handler
+}
+
+// ThenFunc wraps a http.HandlerFunc with authorization
+func (a *Authorizer) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return a.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with authorization
+func (a *Authorizer) Then(h http.Handler) http.Handler {
+	return a.Handler(h)
+}
+
+// Handler returns a http.Handler that checks the user of each request against the Policy
+//
+// It should be placed after an authentication handler so the user is stored in the request
+func (a *Authorizer) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := a.Policy.Authorize(GetUser(req), req); err != nil {
+			if _, ok := err.(*ForbiddenError); !ok {
+				err = &ForbiddenError{err.Error()}
+			}
+			a.OnError.Handle(w, req, err, http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// NewAuthorizer creates an Authorizer that checks each request against policy
+//
+// Usage:
+//  keyAuth := auth.NewXAPIKey(auth.FinderFunc(finder), failure.HandlerFunc(onError))
+//  admin := auth.NewAuthorizer(auth.RequireRole("admin"), failure.HandlerFunc(onError))
+//
+//  http.Handle("/admin", keyAuth.Then(admin.Then(router)))
+func NewAuthorizer(policy Policy, onError failure.Handler) *Authorizer {
+	return &Authorizer{policy, onError}
+}
@@ -0,0 +1,104 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	roles  []string
+	scopes []string
+}
+
+func (u *testUser) HasRole(role string) bool {
+	for _, r := range u.roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *testUser) HasScope(scope string) bool {
+	for _, s := range u.scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPolicies(t *testing.T) {
+	t.Parallel()
+
+	admin := &testUser{[]string{"admin"}, []string{"read", "write"}}
+	reader := &testUser{[]string{"user"}, []string{"read"}}
+	getOnly := PolicyFunc(func(user interface{}, r *http.Request) bool {
+		return r.Method == "GET"
+	})
+	erroring := &policyError{errors.New("database unavailable")}
+
+	cases := map[string]struct {
+		policy  Policy
+		user    interface{}
+		method  string
+		allowed bool
+	}{
+		"role":                    {RequireRole("admin"), admin, "GET", true},
+		"missing role":            {RequireRole("admin"), reader, "GET", false},
+		"any role":                {RequireRole("admin", "user"), reader, "GET", true},
+		"role without role user":  {RequireRole("admin"), "some user", "GET", false},
+		"role without any user":   {RequireRole("admin"), nil, "GET", false},
+		"scopes":                  {RequireScopes("read", "write"), admin, "POST", true},
+		"missing scope":           {RequireScopes("read", "write"), reader, "POST", false},
+		"predicate":               {getOnly, nil, "GET", true},
+		"failing predicate":       {getOnly, admin, "POST", false},
+		"all":                     {RequireAll(RequireRole("user"), getOnly), reader, "GET", true},
+		"all with one failing":    {RequireAll(RequireRole("user"), getOnly), reader, "POST", false},
+		"any":                     {RequireAny(RequireRole("admin"), getOnly), reader, "GET", true},
+		"any with all failing":    {RequireAny(RequireRole("admin"), getOnly), reader, "POST", false},
+		"any without policies":    {RequireAny(), admin, "GET", false},
+		"non forbidden error":     {erroring, admin, "GET", false},
+		"claims scope and roles":  {RequireAll(RequireScopes("items:read"), RequireRole("staff")), &Claims{Raw: map[string]interface{}{"scope": "items:read items:write", "roles": []interface{}{"staff"}}}, "GET", true},
+		"claims scp list":         {RequireScopes("items:read"), &Claims{Raw: map[string]interface{}{"scp": []interface{}{"items:read"}}}, "GET", true},
+		"claims missing scope":    {RequireScopes("items:delete"), &Claims{Raw: map[string]interface{}{"scope": "items:read"}}, "GET", false},
+		"claims single role text": {RequireRole("staff"), &Claims{Raw: map[string]interface{}{"roles": "staff"}}, "GET", true},
+	}
+
+	for k, tc := range cases {
+		called := false
+		authorizer := NewAuthorizer(tc.policy, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			called = true
+			assert.False(t, tc.allowed, "test: %s", k)
+			assert.IsType(t, &ForbiddenError{}, err, "test: %s", k)
+			assert.Equal(t, http.StatusForbidden, status, "test: %s", k)
+		}))
+		req := saveUser(headerRequest(t, tc.method, "/path", map[string]string{}), tc.user)
+		authorizer.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			assert.True(t, tc.allowed, "test: %s", k)
+		}).ServeHTTP(httptest.NewRecorder(), req)
+		assert.True(t, called, "test: %s", k)
+	}
+}
+
+type policyError struct{ err error }
+
+func (p *policyError) Authorize(user interface{}, r *http.Request) error {
+	return p.err
+}
@@ -0,0 +1,120 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graze/golang-service/handlers/failure"
+)
+
+// Basic authenticates requests using HTTP Basic authentication: `Authorization: Basic <base64(username:password)>`
+type Basic struct {
+	// Realm is sent to the client in the WWW-Authenticate challenge
+	Realm string
+	// Finder takes the provided BasicCredentials and returns a user object or error if they are invalid
+	Finder Finder
+	// OnError gets called if the request is unauthorized or forbidden
+	OnError failure.Handler
+}
+
+// BasicCredentials are the username and password supplied to the Finder by Basic
+type BasicCredentials struct {
+	Username string
+	Password string
+}
+
+// ThenFunc wraps a http.HandlerFunc with basic authentication
+func (b *Basic) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return b.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with basic authentication
+func (b *Basic) Then(h http.Handler) http.Handler {
+	return b.Handler(h)
+}
+
+// Handler returns a http.Handler that checks the basic credentials of each request using the Finder
+//
+// All failures include a `WWW-Authenticate: Basic realm="<realm>"` challenge header
+func (b *Basic) Handler(h http.Handler) http.Handler {
+	return authHandler(b, b.OnError, h)
+}
+
+// Authenticate checks the basic credentials of req and returns the user found by the Finder
+func (b *Basic) Authenticate(req *http.Request) (interface{}, error) {
+	header := req.Header["Authorization"]
+	if len(header) == 0 {
+		return nil, &NoHeaderError{}
+	}
+	if scheme := strings.SplitN(header[0], " ", 2)[0]; !strings.EqualFold(scheme, "Basic") {
+		return nil, &BadProviderError{scheme, "Basic"}
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, &InvalidFormatError{"Basic <base64(username:password)>", header[0]}
+	}
+
+	user, err := b.Finder.Find(BasicCredentials{username, password}, req)
+	if err != nil {
+		return nil, &InvalidKeyError{username, err}
+	}
+	return user, nil
+}
+
+// suppliedKey returns the username of the basic credentials of req
+func (b *Basic) suppliedKey(req *http.Request) string {
+	username, _, _ := req.BasicAuth()
+	return username
+}
+
+// Challenge returns the WWW-Authenticate challenge sent to the client when authentication fails
+func (b *Basic) Challenge() string {
+	return "Basic realm=" + strconv.Quote(b.Realm)
+}
+
+// NewBasic creates a new Basic authenticator
+func NewBasic(realm string, finder Finder, onError failure.Handler) *Basic {
+	return &Basic{realm, finder, onError}
+}
+
+// BasicUsers is a static map of username to password that implements Finder for use with Basic
+//
+// The username is returned as the user if the credentials match
+type BasicUsers map[string]string
+
+// Find compares the supplied BasicCredentials against the static set of users in constant time
+func (u BasicUsers) Find(c interface{}, r *http.Request) (interface{}, error) {
+	creds, ok := c.(BasicCredentials)
+	if !ok {
+		return nil, fmt.Errorf("invalid credentials format, expecting BasicCredentials")
+	}
+
+	// always compare against something so a missing user takes the same time as a wrong password
+	password, found := u[creds.Username]
+	if !SecureCompare(password, creds.Password) || !found {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+	return creds.Username, nil
+}
+
+// SecureCompare checks if a and b are equal in constant time, independent of the length of either value
+func SecureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,111 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+func basicRequest(t *testing.T, username, password string) *http.Request {
+	req := headerRequest(t, "GET", "/path", map[string]string{})
+	req.SetBasicAuth(username, password)
+	return req
+}
+
+func TestBasicAuthErrors(t *testing.T) {
+	t.Parallel()
+
+	users := BasicUsers{"admin": "secret"}
+
+	cases := map[string]struct {
+		request *http.Request
+		err     error
+	}{
+		"no header": {
+			headerRequest(t, "GET", "/path", map[string]string{}),
+			&NoHeaderError{},
+		},
+		"other scheme": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Graze key"}),
+			&BadProviderError{},
+		},
+		"invalid encoding": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Basic not-base64!"}),
+			&InvalidFormatError{},
+		},
+		"wrong password": {
+			basicRequest(t, "admin", "nope"),
+			&InvalidKeyError{},
+		},
+		"unknown user": {
+			basicRequest(t, "someone", "secret"),
+			&InvalidKeyError{},
+		},
+		"empty password for unknown user": {
+			basicRequest(t, "someone", ""),
+			&InvalidKeyError{},
+		},
+	}
+
+	for k, tc := range cases {
+		rec := httptest.NewRecorder()
+		called := false
+		auth := NewBasic("admin area", users, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			called = true
+			assert.IsType(t, tc.err, err, "test: %s", k)
+			assert.Equal(t, http.StatusUnauthorized, status, "test: %s", k)
+		}))
+		auth.Then(okHandler).ServeHTTP(rec, tc.request)
+		assert.True(t, called, "test: %s", k)
+		assert.Equal(t, `Basic realm="admin area"`, rec.Header().Get("WWW-Authenticate"), "test: %s", k)
+	}
+}
+
+func TestValidBasicAuth(t *testing.T) {
+	t.Parallel()
+
+	auth := NewBasic("admin area", BasicUsers{"admin": "secret"}, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+		t.Errorf("onError handler called. Err: %s, Status: %d", err, status)
+	}))
+
+	called := false
+	handler := auth.ThenFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		assert.Equal(t, "admin", GetUser(req))
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, basicRequest(t, "admin", "secret"))
+	assert.True(t, called)
+	assert.Equal(t, "", rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestBasicFinderReceivesCredentials(t *testing.T) {
+	finder := FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+		assert.Equal(t, BasicCredentials{"user", "pass:with:colons"}, c)
+		return "user", nil
+	})
+	auth := NewBasic("", finder, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+		t.Errorf("onError handler called. Err: %s, Status: %d", err, status)
+	}))
+	auth.Then(okHandler).ServeHTTP(httptest.NewRecorder(), basicRequest(t, "user", "pass:with:colons"))
+}
+
+func TestSecureCompare(t *testing.T) {
+	assert.True(t, SecureCompare("secret", "secret"))
+	assert.True(t, SecureCompare("", ""))
+	assert.False(t, SecureCompare("secret", "secre"))
+	assert.False(t, SecureCompare("secret", "Secret"))
+}
@@ -0,0 +1,241 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/graze/golang-service/metrics"
+)
+
+// CachingFinder is a Finder that caches the results of another Finder
+//
+// Successful lookups are cached for TTL and failed lookups for NegativeTTL. At most Size entries are kept, with the
+// least recently used entry being evicted first. Concurrent lookups for the same credentials only call the wrapped
+// Finder once.
+//
+// The request passed to the wrapped Finder is the request of the first lookup, the result is shared with every
+// request using the same credentials. Credentials that are not comparable (maps, slices) are never cached.
+//
+// The same user value is returned to every request until the entry expires, so users returned by the wrapped Finder
+// must not be modified. A pointer user (such as *Claims) changed by one request is changed for every later request;
+// copy the user before changing it.
+type CachingFinder struct {
+	finder      Finder
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+
+	mu       sync.Mutex
+	entries  map[interface{}]*list.Element
+	lru      *list.List
+	calls    map[interface{}]*finderCall
+	stats    CacheStats
+	reported CacheStats
+}
+
+// CacheStats are the counters of a CachingFinder
+type CacheStats struct {
+	// Hits is the number of lookups returned from a cached successful lookup
+	Hits int64
+	// NegativeHits is the number of lookups returned from a cached failed lookup
+	NegativeHits int64
+	// Misses is the number of lookups that called the wrapped Finder
+	Misses int64
+	// Shared is the number of lookups that waited for a concurrent lookup of the same credentials
+	Shared int64
+	// Evictions is the number of entries removed to keep the cache within its size
+	Evictions int64
+	// Size is the current number of cached entries
+	Size int
+}
+
+// cacheEntry is a single cached lookup
+type cacheEntry struct {
+	key     interface{}
+	user    interface{}
+	err     error
+	expires time.Time
+}
+
+// finderCall is an in flight lookup that concurrent lookups for the same credentials wait on
+type finderCall struct {
+	wg          sync.WaitGroup
+	user        interface{}
+	err         error
+	invalidated bool
+}
+
+// NewCachingFinder creates a CachingFinder wrapping finder
+//
+// Usage:
+//  finder := auth.NewCachingFinder(auth.FinderFunc(dbFinder), 5*time.Minute, 30*time.Second, 10000)
+//  keyAuth := auth.NewXAPIKey(finder, failure.HandlerFunc(onError))
+func NewCachingFinder(finder Finder, ttl, negativeTTL time.Duration, size int) *CachingFinder {
+	return &CachingFinder{
+		finder:      finder,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		size:        size,
+		entries:     make(map[interface{}]*list.Element),
+		lru:         list.New(),
+		calls:       make(map[interface{}]*finderCall),
+	}
+}
+
+// Find returns the cached result for credentials or calls the wrapped Finder
+func (f *CachingFinder) Find(credentials interface{}, r *http.Request) (interface{}, error) {
+	if credentials == nil || !reflect.TypeOf(credentials).Comparable() {
+		return f.finder.Find(credentials, r)
+	}
+
+	f.mu.Lock()
+	if el, ok := f.entries[credentials]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			f.lru.MoveToFront(el)
+			if entry.err != nil {
+				f.stats.NegativeHits++
+			} else {
+				f.stats.Hits++
+			}
+			f.mu.Unlock()
+			return entry.user, entry.err
+		}
+		f.remove(el)
+	}
+	if call, ok := f.calls[credentials]; ok {
+		f.stats.Shared++
+		f.mu.Unlock()
+		call.wg.Wait()
+		return call.user, call.err
+	}
+	f.stats.Misses++
+	call := &finderCall{}
+	call.wg.Add(1)
+	f.calls[credentials] = call
+	f.mu.Unlock()
+
+	// if the wrapped Finder panics the waiting lookups get an error, nothing is cached and the panic continues
+	call.err = errors.New("finder panicked")
+	completed := false
+	defer func() {
+		f.mu.Lock()
+		if f.calls[credentials] == call {
+			delete(f.calls, credentials)
+		}
+		if completed && !call.invalidated {
+			f.store(credentials, call.user, call.err)
+		}
+		f.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.user, call.err = f.finder.Find(credentials, r)
+	completed = true
+	return call.user, call.err
+}
+
+// store adds the result of a lookup to the cache, evicting the least recently used entries if required
+func (f *CachingFinder) store(key, user interface{}, err error) {
+	ttl := f.ttl
+	if err != nil {
+		ttl = f.negativeTTL
+	}
+	if ttl <= 0 || f.size <= 0 {
+		return
+	}
+
+	f.entries[key] = f.lru.PushFront(&cacheEntry{key, user, err, time.Now().Add(ttl)})
+	for f.lru.Len() > f.size {
+		f.remove(f.lru.Back())
+		f.stats.Evictions++
+	}
+}
+
+// remove deletes a single entry from the cache
+func (f *CachingFinder) remove(el *list.Element) {
+	f.lru.Remove(el)
+	delete(f.entries, el.Value.(*cacheEntry).key)
+}
+
+// Invalidate removes any cached result for credentials
+//
+// The result of a lookup in flight when Invalidate is called is not cached, and later lookups do not wait for it
+func (f *CachingFinder) Invalidate(credentials interface{}) {
+	if credentials == nil || !reflect.TypeOf(credentials).Comparable() {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if el, ok := f.entries[credentials]; ok {
+		f.remove(el)
+	}
+	if call, ok := f.calls[credentials]; ok {
+		call.invalidated = true
+		delete(f.calls, credentials)
+	}
+}
+
+// Stats returns the current counters of the cache
+func (f *CachingFinder) Stats() CacheStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.stats
+	stats.Size = f.lru.Len()
+	return stats
+}
+
+// Report sends the counters since the last call to Report and the size of the cache to a metrics client
+//
+// The metrics sent are:
+//  auth.finder.cache.hits          - count
+//  auth.finder.cache.negative_hits - count
+//  auth.finder.cache.misses        - count
+//  auth.finder.cache.shared        - count
+//  auth.finder.cache.evictions     - count
+//  auth.finder.cache.size          - gauge
+//
+// Usage:
+//  client, _ := metrics.GetStatsdFromEnv()
+//  go func() {
+//      for range time.Tick(10 * time.Second) {
+//          finder.Report(client, []string{"finder:api_keys"})
+//      }
+//  }()
+func (f *CachingFinder) Report(client metrics.Client, tags []string) error {
+	f.mu.Lock()
+	stats, last := f.stats, f.reported
+	f.reported = stats
+	size := f.lru.Len()
+	f.mu.Unlock()
+
+	for _, m := range []struct {
+		name  string
+		value int64
+	}{
+		{"auth.finder.cache.hits", stats.Hits - last.Hits},
+		{"auth.finder.cache.negative_hits", stats.NegativeHits - last.NegativeHits},
+		{"auth.finder.cache.misses", stats.Misses - last.Misses},
+		{"auth.finder.cache.shared", stats.Shared - last.Shared},
+		{"auth.finder.cache.evictions", stats.Evictions - last.Evictions},
+	} {
+		if err := client.Count(m.name, m.value, tags, 1); err != nil {
+			return err
+		}
+	}
+	return client.Gauge("auth.finder.cache.size", float64(size), tags, 1)
+}
@@ -0,0 +1,239 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/graze/golang-service/nettest"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingFinder returns the key as the user, or an error for the key "bad", and counts the calls per key
+type countingFinder struct {
+	mu    sync.Mutex
+	calls map[interface{}]int
+	delay time.Duration
+}
+
+func (f *countingFinder) Find(c interface{}, r *http.Request) (interface{}, error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[interface{}]int)
+	}
+	f.calls[c]++
+	f.mu.Unlock()
+	time.Sleep(f.delay)
+	if c == "bad" {
+		return nil, errors.New("bad key")
+	}
+	return c, nil
+}
+
+func (f *countingFinder) count(c interface{}) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[c]
+}
+
+func TestCachingFinderCaches(t *testing.T) {
+	finder := &countingFinder{}
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 10)
+
+	for i := 0; i < 3; i++ {
+		user, err := cache.Find("key", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "key", user)
+
+		_, err = cache.Find("bad", nil)
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, 1, finder.count("key"))
+	assert.Equal(t, 1, finder.count("bad"))
+	assert.Equal(t, CacheStats{Hits: 2, NegativeHits: 2, Misses: 2, Size: 2}, cache.Stats())
+}
+
+func TestCachingFinderExpiry(t *testing.T) {
+	finder := &countingFinder{}
+	cache := NewCachingFinder(finder, time.Minute, 10*time.Millisecond, 10)
+
+	cache.Find("key", nil)
+	cache.Find("bad", nil)
+	time.Sleep(20 * time.Millisecond)
+	cache.Find("key", nil)
+	cache.Find("bad", nil)
+
+	assert.Equal(t, 1, finder.count("key"), "positive entries live for the ttl")
+	assert.Equal(t, 2, finder.count("bad"), "negative entries expire after the negative ttl")
+}
+
+func TestCachingFinderEvictsLeastRecentlyUsed(t *testing.T) {
+	finder := &countingFinder{}
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 2)
+
+	cache.Find("a", nil)
+	cache.Find("b", nil)
+	cache.Find("a", nil)
+	cache.Find("c", nil) // evicts b
+	cache.Find("a", nil)
+	cache.Find("b", nil)
+
+	assert.Equal(t, 1, finder.count("a"))
+	assert.Equal(t, 2, finder.count("b"))
+	assert.Equal(t, int64(2), cache.Stats().Evictions)
+	assert.Equal(t, 2, cache.Stats().Size)
+}
+
+func TestCachingFinderSharesConcurrentLookups(t *testing.T) {
+	finder := &countingFinder{delay: 20 * time.Millisecond}
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 10)
+
+	var wg sync.WaitGroup
+	var found int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if user, _ := cache.Find("key", nil); user == "key" {
+				atomic.AddInt32(&found, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, finder.count("key"))
+	assert.Equal(t, int32(10), found)
+}
+
+func TestCachingFinderInvalidate(t *testing.T) {
+	finder := &countingFinder{}
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 10)
+
+	cache.Find("key", nil)
+	cache.Invalidate("key")
+	cache.Find("key", nil)
+	assert.Equal(t, 2, finder.count("key"))
+}
+
+func TestCachingFinderInvalidateDuringLookup(t *testing.T) {
+	finder := &countingFinder{delay: 20 * time.Millisecond}
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 10)
+
+	done := make(chan struct{})
+	go func() {
+		cache.Find("key", nil)
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cache.Invalidate("key")
+	<-done
+
+	cache.Find("key", nil)
+	assert.Equal(t, 2, finder.count("key"), "the result of the invalidated lookup is not cached")
+}
+
+func TestCachingFinderPanickingFinder(t *testing.T) {
+	calls := int32(0)
+	finder := FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(20 * time.Millisecond)
+			panic("database gone")
+		}
+		return c, nil
+	})
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 10)
+
+	waiting := make(chan error)
+	go func() {
+		defer func() { recover() }()
+		cache.Find("key", nil)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	go func() {
+		_, err := cache.Find("key", nil)
+		waiting <- err
+	}()
+
+	select {
+	case err := <-waiting:
+		assert.Error(t, err, "lookups waiting on a panicking finder get an error")
+	case <-time.After(time.Second):
+		t.Fatal("waiting lookup blocked after the finder panicked")
+	}
+
+	result := make(chan interface{})
+	go func() {
+		user, _ := cache.Find("key", nil)
+		result <- user
+	}()
+	select {
+	case user := <-result:
+		assert.Equal(t, "key", user, "later lookups call the finder again")
+	case <-time.After(time.Second):
+		t.Fatal("lookup blocked after the finder panicked")
+	}
+}
+
+func TestCachingFinderSkipsUncomparableCredentials(t *testing.T) {
+	finder := FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+		return "user", nil
+	})
+	cache := NewCachingFinder(finder, time.Minute, time.Minute, 10)
+
+	user, err := cache.Find(map[string]string{"a": "b"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, 0, cache.Stats().Size)
+}
+
+func TestCachingFinderReport(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWg := nettest.CreateServer(t, "udp", "localhost:", done)
+	defer srvWg.Wait()
+	defer os.Remove(addr.String())
+	defer sock.Close()
+
+	client, err := statsd.New(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCachingFinder(&countingFinder{}, time.Minute, time.Minute, 10)
+	cache.Find("key", nil)
+	cache.Find("key", nil)
+
+	assert.NoError(t, cache.Report(client, []string{"finder:test"}))
+	for _, expected := range []string{
+		"auth.finder.cache.hits:1|c|#finder:test",
+		"auth.finder.cache.negative_hits:0|c|#finder:test",
+		"auth.finder.cache.misses:1|c|#finder:test",
+		"auth.finder.cache.shared:0|c|#finder:test",
+		"auth.finder.cache.evictions:0|c|#finder:test",
+		"auth.finder.cache.size:1.000000|g|#finder:test",
+	} {
+		assert.Equal(t, expected, <-done)
+	}
+
+	cache.Find("key", nil)
+	assert.NoError(t, cache.Report(client, []string{}))
+	assert.Equal(t, "auth.finder.cache.hits:1|c", <-done, "only reports the counts since the last report")
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+}
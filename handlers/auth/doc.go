@@ -31,7 +31,7 @@ The Finder and FailHandler are common to all authentication types
         }
         user, ok := users[k]
         if !ok {
-            return nil, fmt.Errorf("No user found for: %s", key)
+            return nil, fmt.Errorf("No user found")
         }
         return user, nil
     }
@@ -41,6 +41,27 @@ The Finder and FailHandler are common to all authentication types
         fmt.Fprintf(w, err.Error())
     }
 
+Caching Finders
+
+Lookups can be cached by wrapping a Finder with NewCachingFinder. Successful lookups are kept for the TTL, failed
+lookups for the (usually shorter) negative TTL, and the least recently used entries are evicted once the size is
+reached. Concurrent lookups of the same credentials only call the wrapped Finder once.
+
+    finder := auth.NewCachingFinder(auth.FinderFunc(finder), 5*time.Minute, 30*time.Second, 10000)
+    keyAuth := auth.NewXAPIKey(finder, failure.HandlerFunc(onError))
+
+The hit and miss counters are available from Stats, or can be sent to statsd with Report.
+
+Lockout
+
+A Lockout wraps an authenticator and counts the InvalidKeyError failures per client ip and key prefix. Once the
+threshold is reached within the window the client ip or key prefix gets http.StatusTooManyRequests with a
+Retry-After header for the lockout duration, even if the supplied key is valid. Each lockout is logged as a warning.
+
+    keyAuth := auth.NewXAPIKey(finder, nil)
+    lockout := auth.NewLockout(keyAuth, 10, time.Minute, 15*time.Minute, failure.HandlerFunc(onError))
+    http.Handle("/", lockout.Then(router))
+
 Authorization Bearer Api Key Auth
 
 For a basic api key based authentication. It directly passes the apiKey as a the credentials to the Finder.Func method
@@ -60,6 +81,67 @@ Usage:
 
     http.Handle("/", keyAuth.Next(router))
 
+Basic Authorization
+
+HTTP Basic authentication passes a BasicCredentials struct containing the username and password to the Finder. When the
+authentication fails a `WWW-Authenticate: Basic realm="<realm>"` challenge is added to the response before OnError is
+called. A static map of users can be used with BasicUsers, which compares passwords in constant time.
+
+Usage:
+    basicAuth := auth.NewBasic("admin", auth.BasicUsers{"admin": os.Getenv("ADMIN_PASSWORD")}, failure.HandlerFunc(onError))
+
+    http.Handle("/admin", basicAuth.Then(router))
+
+JWT Bearer Authorization
+
+Verifies a signed JSON Web Token supplied as: `Authorization: Bearer <token>`. HS256, RS256 and ES256 signatures are
+supported using a StaticKeySet or the keys from a JWKS document. The `exp` and `nbf` claims are checked (allowing for
+Leeway) along with the `iss` and `aud` claims if Issuer or Audience are set. The verified *Claims are passed to the
+Finder
+
+Usage:
+    keys, err := auth.ParseJWKS(jwksFile)
+    jwtAuth := auth.NewJWT(keys, auth.FinderFunc(claimsFinder), failure.HandlerFunc(onError))
+    jwtAuth.Issuer = "https://auth.example.com/"
+    jwtAuth.Leeway = 30 * time.Second
+
+    http.Handle("/", jwtAuth.Then(router))
+
+HMAC Request Signing
+
+For service to service calls requests can be signed with a shared secret instead of sending a key in the clear.
+The Authorization header is in the format: `<provider> <keyID>:<signature>` where the signature is a HMAC-SHA256 of the
+method, path, X-Auth-Timestamp and X-Auth-Nonce headers, a list of selected headers and a digest of the body.
+Requests outside of the Window are rejected and each nonce can only be used once.
+
+The Finder is given the keyID and must return a *SigningKey containing the secret and the user.
+
+Usage:
+    hmacAuth := auth.NewHMAC("Graze-HMAC", auth.FinderFunc(keyFinder), failure.HandlerFunc(onError))
+    hmacAuth.Headers = []string{"Content-Type"}
+
+    http.Handle("/", hmacAuth.Then(router))
+
+Requests can be signed using SignRequest:
+
+    req, _ := http.NewRequest("POST", "https://service.example.com/items", body)
+    req.Header.Set("Content-Type", "application/json")
+    err := auth.SignRequest(req, "Graze-HMAC", "service-a", secret, []string{"Content-Type"})
+
+Multiple Authentication Schemes
+
+Several authenticators can be combined. FirstOf uses the first scheme that has credentials supplied; if those
+credentials are invalid the request fails rather than trying the next scheme. AllOf requires every scheme to pass.
+The name of the scheme that authenticated the request can be retrieved using GetScheme.
+
+Usage:
+    keyAuth := auth.FirstOf(failure.HandlerFunc(onError),
+        auth.Scheme{Name: "x-api-key", Authenticator: auth.NewXAPIKey(auth.FinderFunc(finder), nil)},
+        auth.Scheme{Name: "graze", Authenticator: auth.NewAPIKey("Graze", auth.FinderFunc(finder), nil)},
+    )
+
+    http.Handle("/", keyAuth.Then(router))
+
 Usage
 
 Authentication can be added to a handler chain too:
@@ -70,6 +152,34 @@ Or using something like `alice`:
 
     chain := alice.New(first, second, keyAuth.Handler, fourth)
 
+Authorization
+
+Once a request is authenticated an Authorizer can check the user against a Policy. If the policy fails the OnError
+handler is called with http.StatusForbidden and a *ForbiddenError.
+
+Policies can require roles (users implementing RoleHolder), scopes (users implementing ScopeHolder) or be any
+predicate over the user and request using PolicyFunc. They can be combined using RequireAll and RequireAny.
+*Claims from a JWT implement both using the `roles`, `scope` and `scp` claims.
+
+Usage:
+    admin := auth.NewAuthorizer(auth.RequireRole("admin"), failure.HandlerFunc(onError))
+    writer := auth.NewAuthorizer(auth.RequireAny(
+        auth.RequireScopes("items:write"),
+        auth.PolicyFunc(func(user interface{}, r *http.Request) bool {
+            return r.Method == "GET"
+        }),
+    ), failure.HandlerFunc(onError))
+
+    http.Handle("/admin", keyAuth.Then(admin.Then(adminRouter)))
+    http.Handle("/items", keyAuth.Then(writer.Then(itemRouter)))
+
+Redaction
+
+The errors returned during authentication do not contain the supplied keys. InvalidKeyError and InvalidFormatError
+show a Fingerprint of the key instead, which can be changed by setting Redact:
+
+    auth.Redact = auth.Truncate(4) // provided api key: 'abcd...' is not valid
+
 User Retrieval
 
 The authentication also adds the user field returned by the finder to the
@@ -82,5 +192,15 @@ context object on the request. It can be retireved using the `auth.GetUser` meth
             return
         }
     }
+
+Or without the type assertion using `auth.UserAs`:
+
+    func GetList(w http.ResponseWriter, r *http.Request) {
+        var user *account.User
+        if !auth.UserAs(r, &user) {
+            w.WriteHeader(403)
+            return
+        }
+    }
 */
 package auth
@@ -26,7 +26,7 @@ import "net/http"
 // 		}
 // 		user, ok := users[key]
 // 		if !ok {
-// 			return nil, fmt.Errorf("No user found for: %s", key)
+// 			return nil, fmt.Errorf("No user found")
 // 		}
 // 		return user, nil
 // 	}
@@ -0,0 +1,323 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graze/golang-service/handlers/failure"
+)
+
+// Headers used to send the signing timestamp and nonce of a HMAC signed request
+const (
+	HMACTimestampHeader = "X-Auth-Timestamp"
+	HMACNonceHeader     = "X-Auth-Nonce"
+)
+
+// DefaultHMACMaxBodySize is the default maximum size in bytes of the body of a HMAC signed request
+const DefaultHMACMaxBodySize = 10 << 20
+
+// HMAC authenticates service to service requests signed with a shared secret
+//
+// The Authorization header is in the format: <provider> <keyID>:<signature> where signature is the base64 encoded
+// HMAC-SHA256 of the method, path, timestamp, nonce, selected headers and a SHA256 digest of the body
+type HMAC struct {
+	// Provider is the name of the scheme in the Authorization header. It must not contain any spaces
+	Provider string
+	// Headers is the list of extra headers that are included in the signature
+	Headers []string
+	// Window is the maximum difference between the request timestamp and the current time
+	Window time.Duration
+	// Nonces records the nonce of each request to block replays. If nil, nonces are not checked
+	Nonces NonceStore
+	// Finder takes the provided <keyID> and returns a SigningKey or error if the key is invalid
+	Finder Finder
+	// OnError gets called if the request is unauthorized or forbidden
+	OnError failure.Handler
+	// MaxBodySize is the maximum size in bytes of a request body that is read to verify the signature. Larger requests
+	// are rejected with http.StatusRequestEntityTooLarge. Defaults to DefaultHMACMaxBodySize
+	MaxBodySize int64
+}
+
+// SigningKey is returned by the Finder used with HMAC with the shared secret for a key id and the user it identifies
+type SigningKey struct {
+	Secret []byte
+	User   interface{}
+}
+
+type (
+	// InvalidSignatureError if the signature does not match the request
+	InvalidSignatureError struct{}
+	// RequestExpiredError if the timestamp of the request is outside of the allowed window
+	RequestExpiredError struct{ timestamp time.Time }
+	// ReplayedRequestError if the nonce of a request has already been used
+	ReplayedRequestError struct{ nonce string }
+	// BodyTooLargeError if the body of a request is larger than the maximum size that will be read
+	BodyTooLargeError struct{ limit int64 }
+)
+
+func (e *InvalidSignatureError) Error() string {
+	return "provided signature does not match the request"
+}
+
+func (e *RequestExpiredError) Error() string {
+	return fmt.Sprintf("request timestamp: %s is outside of the allowed window", e.timestamp.Format(time.RFC3339))
+}
+
+func (e *ReplayedRequestError) Error() string {
+	return fmt.Sprintf("request nonce: '%s' has already been used", e.nonce)
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body is larger than the limit of %d bytes", e.limit)
+}
+
+// ThenFunc wraps a http.HandlerFunc with HMAC authentication
+func (a *HMAC) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return a.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with HMAC authentication
+func (a *HMAC) Then(h http.Handler) http.Handler {
+	return a.Handler(h)
+}
+
+// Handler returns a http.Handler that verifies the signature of each request
+func (a *HMAC) Handler(h http.Handler) http.Handler {
+	return authHandler(a, a.OnError, h)
+}
+
+// Authenticate verifies the signature of req and returns the user of the SigningKey found by the Finder
+func (a *HMAC) Authenticate(req *http.Request) (interface{}, error) {
+	header := req.Header["Authorization"]
+	if len(header) == 0 {
+		return nil, &NoHeaderError{}
+	}
+
+	parts := strings.Split(header[0], " ")
+	if len(parts) != 2 {
+		return nil, &InvalidFormatError{"<provider> <keyID>:<signature>", header[0]}
+	}
+	provider, value := parts[0], parts[1]
+	if provider != a.Provider {
+		return nil, &BadProviderError{provider, a.Provider}
+	}
+	i := strings.LastIndex(value, ":")
+	if i <= 0 {
+		return nil, &InvalidFormatError{"<provider> <keyID>:<signature>", header[0]}
+	}
+	keyID := value[:i]
+	signature, err := base64.StdEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return nil, &InvalidFormatError{"<provider> <keyID>:<signature>", header[0]}
+	}
+
+	unix, err := strconv.ParseInt(req.Header.Get(HMACTimestampHeader), 10, 64)
+	if err != nil {
+		return nil, &InvalidFormatError{HMACTimestampHeader + ": <unix timestamp>", req.Header.Get(HMACTimestampHeader)}
+	}
+	timestamp := time.Unix(unix, 0)
+	if d := time.Since(timestamp); d > a.window() || d < -a.window() {
+		return nil, &RequestExpiredError{timestamp}
+	}
+	nonce := req.Header.Get(HMACNonceHeader)
+	if a.Nonces != nil && nonce == "" {
+		return nil, &InvalidFormatError{HMACNonceHeader + ": <nonce>", nonce}
+	}
+
+	found, err := a.Finder.Find(keyID, req)
+	if err != nil {
+		return nil, &InvalidKeyError{keyID, err}
+	}
+	key, ok := found.(*SigningKey)
+	if !ok || key == nil {
+		return nil, &InvalidKeyError{keyID, fmt.Errorf("finder did not return a *SigningKey")}
+	}
+
+	expected, err := signRequest(req, key.Secret, a.Headers, a.maxBodySize())
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(expected, signature) {
+		return nil, &InvalidSignatureError{}
+	}
+
+	if a.Nonces != nil && !a.Nonces.Add(keyID+":"+nonce, timestamp.Add(a.window())) {
+		return nil, &ReplayedRequestError{nonce}
+	}
+	return key.User, nil
+}
+
+// suppliedKey returns the key id in the Authorization header of req, or "" if there is none
+func (a *HMAC) suppliedKey(req *http.Request) string {
+	parts := strings.Split(req.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != a.Provider {
+		return ""
+	}
+	if i := strings.LastIndex(parts[1], ":"); i > 0 {
+		return parts[1][:i]
+	}
+	return ""
+}
+
+// window returns the allowed time window for requests, defaulting to 5 minutes
+func (a *HMAC) window() time.Duration {
+	if a.Window <= 0 {
+		return 5 * time.Minute
+	}
+	return a.Window
+}
+
+// maxBodySize returns the maximum size of a request body, defaulting to DefaultHMACMaxBodySize
+func (a *HMAC) maxBodySize() int64 {
+	if a.MaxBodySize <= 0 {
+		return DefaultHMACMaxBodySize
+	}
+	return a.MaxBodySize
+}
+
+// NewHMAC creates a new HMAC authenticator with a 5 minute window and an in memory nonce store
+func NewHMAC(provider string, finder Finder, onError failure.Handler) *HMAC {
+	return &HMAC{
+		Provider: provider,
+		Window:   5 * time.Minute,
+		Nonces:   NewMemoryNonceStore(),
+		Finder:   finder,
+		OnError:  onError,
+	}
+}
+
+// SignRequest adds a timestamp, nonce and the signature of req to the headers of req
+//
+// headers must match the Headers configured on the receiving HMAC authenticator
+func SignRequest(req *http.Request, provider, keyID string, secret []byte, headers []string) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	req.Header.Set(HMACTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(HMACNonceHeader, hex.EncodeToString(nonce))
+
+	signature, err := signRequest(req, secret, headers, 0)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", provider+" "+keyID+":"+base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// signRequest creates the HMAC-SHA256 signature of req
+//
+// The signed content is each of the following separated by a new line:
+//  <method>
+//  <path and query>
+//  <timestamp>
+//  <nonce>
+//  <header>:<value> for each header in headers
+//  <hex encoded sha256 of the body>
+//
+// A BodyTooLargeError is returned if the body is larger than limit bytes. If limit is 0 the body is not limited
+func signRequest(req *http.Request, secret []byte, headers []string, limit int64) ([]byte, error) {
+	digest, err := bodyDigest(req, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", req.Method, req.URL.RequestURI(), req.Header.Get(HMACTimestampHeader), req.Header.Get(HMACNonceHeader))
+	for _, h := range headers {
+		fmt.Fprintf(mac, "%s:%s\n", strings.ToLower(h), strings.TrimSpace(req.Header.Get(h)))
+	}
+	mac.Write([]byte(digest))
+	return mac.Sum(nil), nil
+}
+
+// bodyDigest reads the body of req and returns the hex encoded sha256 digest of it, replacing the body so it can be
+// read again
+//
+// No more than limit bytes are read into memory, if limit is greater than 0
+func bodyDigest(req *http.Request, limit int64) (string, error) {
+	var body []byte
+	if req.Body != nil {
+		if limit > 0 && req.ContentLength > limit {
+			return "", &BodyTooLargeError{limit}
+		}
+		var r io.Reader = req.Body
+		if limit > 0 {
+			r = io.LimitReader(req.Body, limit+1)
+		}
+		var err error
+		body, err = ioutil.ReadAll(r)
+		req.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("unable to read request body: %v", err)
+		}
+		if limit > 0 && int64(len(body)) > limit {
+			return "", &BodyTooLargeError{limit}
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NonceStore records nonces that have been used
+type NonceStore interface {
+	// Add records nonce until expires. It returns false if nonce has already been recorded and has not expired
+	Add(nonce string, expires time.Time) bool
+}
+
+// memoryNonceStore is an in memory NonceStore
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewMemoryNonceStore creates a NonceStore that holds nonces in memory. Expired nonces are removed periodically
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Add records nonce until expires. It returns false if nonce has already been recorded and has not expired
+func (s *memoryNonceStore) Add(nonce string, expires time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > time.Minute {
+		for n, e := range s.nonces {
+			if now.After(e) {
+				delete(s.nonces, n)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	if e, ok := s.nonces[nonce]; ok && !now.After(e) {
+		return false
+	}
+	s.nonces[nonce] = expires
+	return true
+}
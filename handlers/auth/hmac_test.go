@@ -0,0 +1,165 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+var signingKeys = FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+	if c == "service-a" {
+		return &SigningKey{[]byte("secret"), "service a"}, nil
+	}
+	return nil, errors.New("unknown key")
+})
+
+func signedRequest(t *testing.T, method, url, body, keyID string, secret []byte) *http.Request {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Service", "a")
+	if err := SignRequest(req, "Graze-HMAC", keyID, secret, []string{"X-Service"}); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestHMACAuthErrors(t *testing.T) {
+	t.Parallel()
+
+	tamperedBody := signedRequest(t, "POST", "/path", `{"a":1}`, "service-a", []byte("secret"))
+	tamperedBody.Body = ioutil.NopCloser(strings.NewReader(`{"a":2}`))
+
+	tamperedHeader := signedRequest(t, "POST", "/path", "", "service-a", []byte("secret"))
+	tamperedHeader.Header.Set("X-Service", "b")
+
+	expired := signedRequest(t, "GET", "/path", "", "service-a", []byte("secret"))
+	expired.Header.Set(HMACTimestampHeader, strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10))
+
+	noNonce := signedRequest(t, "GET", "/path", "", "service-a", []byte("secret"))
+	noNonce.Header.Del(HMACNonceHeader)
+
+	cases := map[string]struct {
+		request *http.Request
+		err     error
+	}{
+		"no header":        {headerRequest(t, "GET", "/path", map[string]string{}), &NoHeaderError{}},
+		"invalid format":   {headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Graze-HMAC key"}), &InvalidFormatError{}},
+		"invalid provider": {signedRequest(t, "GET", "/path", "", "service-a", []byte("secret")), &BadProviderError{}},
+		"unknown key":      {signedRequest(t, "GET", "/path", "", "service-b", []byte("secret")), &InvalidKeyError{}},
+		"wrong secret":     {signedRequest(t, "GET", "/path", "", "service-a", []byte("other")), &InvalidSignatureError{}},
+		"tampered body":    {tamperedBody, &InvalidSignatureError{}},
+		"tampered header":  {tamperedHeader, &InvalidSignatureError{}},
+		"expired":          {expired, &RequestExpiredError{}},
+		"missing nonce":    {noNonce, &InvalidFormatError{}},
+	}
+
+	for k, tc := range cases {
+		provider := "Graze-HMAC"
+		if k == "invalid provider" {
+			provider = "Other"
+		}
+		called := false
+		auth := NewHMAC(provider, signingKeys, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			called = true
+			assert.IsType(t, tc.err, err, "test: %s", k)
+			assert.Equal(t, http.StatusUnauthorized, status, "test: %s", k)
+		}))
+		auth.Headers = []string{"X-Service"}
+		auth.Then(okHandler).ServeHTTP(httptest.NewRecorder(), tc.request)
+		assert.True(t, called, "test: %s", k)
+	}
+}
+
+func TestValidHMACAuth(t *testing.T) {
+	t.Parallel()
+
+	auth := NewHMAC("Graze-HMAC", signingKeys, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+		t.Errorf("onError handler called. Err: %s, Status: %d", err, status)
+	}))
+	auth.Headers = []string{"X-Service"}
+
+	called := false
+	handler := auth.ThenFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		assert.Equal(t, "service a", GetUser(req))
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, `{"a":1}`, string(body), "body can be read again")
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), signedRequest(t, "POST", "/path?q=1", `{"a":1}`, "service-a", []byte("secret")))
+	assert.True(t, called)
+}
+
+func TestHMACRejectsLargeBodies(t *testing.T) {
+	t.Parallel()
+
+	unknownLength := signedRequest(t, "POST", "/path", "0123456789a", "service-a", []byte("secret"))
+	unknownLength.ContentLength = -1
+
+	cases := map[string]struct {
+		request *http.Request
+		status  int
+	}{
+		"at the limit":         {signedRequest(t, "POST", "/path", "0123456789", "service-a", []byte("secret")), http.StatusOK},
+		"over the limit":       {signedRequest(t, "POST", "/path", "0123456789a", "service-a", []byte("secret")), http.StatusRequestEntityTooLarge},
+		"unknown content size": {unknownLength, http.StatusRequestEntityTooLarge},
+	}
+
+	for k, tc := range cases {
+		auth := NewHMAC("Graze-HMAC", signingKeys, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			assert.IsType(t, &BodyTooLargeError{}, err, "test: %s", k)
+			w.WriteHeader(status)
+		}))
+		auth.Headers = []string{"X-Service"}
+		auth.MaxBodySize = 10
+		rec := httptest.NewRecorder()
+		auth.Then(okHandler).ServeHTTP(rec, tc.request)
+		assert.Equal(t, tc.status, rec.Code, "test: %s", k)
+	}
+}
+
+func TestHMACBlocksReplays(t *testing.T) {
+	var errs []error
+	auth := NewHMAC("Graze-HMAC", signingKeys, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+		errs = append(errs, err)
+	}))
+	auth.Headers = []string{"X-Service"}
+
+	req := signedRequest(t, "GET", "/path", "", "service-a", []byte("secret"))
+	handler := auth.Then(okHandler)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, errs, 0)
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.Len(t, errs, 1) {
+		assert.IsType(t, &ReplayedRequestError{}, errs[0])
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+
+	assert.True(t, store.Add("a", time.Now().Add(time.Minute)))
+	assert.False(t, store.Add("a", time.Now().Add(time.Minute)))
+	assert.True(t, store.Add("b", time.Now().Add(-time.Second)))
+	assert.True(t, store.Add("b", time.Now().Add(time.Minute)), "expired nonces can be reused")
+}
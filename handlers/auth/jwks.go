@@ -0,0 +1,143 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// KeySet looks up the key used to verify a token based on the `kid` header of the token
+type KeySet interface {
+	Key(kid string) (interface{}, error)
+}
+
+// StaticKeySet is a fixed set of keys indexed by key id
+//
+// The values must be one of: []byte (HS256), *rsa.PublicKey (RS256) or *ecdsa.PublicKey (ES256)
+type StaticKeySet map[string]interface{}
+
+// Key returns the key for kid. If kid is empty and there is only a single key in the set that key is returned
+func (s StaticKeySet) Key(kid string) (interface{}, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key found for kid: '%s'", kid)
+}
+
+// jwk is a single JSON Web Key as defined in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// Symmetric
+	K string `json:"k"`
+}
+
+// ParseJWKS reads a JSON Web Key Set document from r and returns the keys usable for signature verification
+//
+// Keys with a `use` other than `sig` and keys with an unsupported type or curve are ignored, as providers often publish
+// mixed key sets. An error is returned if no usable key remains
+func ParseJWKS(r io.Reader) (StaticKeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("unable to decode JWKS document: %v", err)
+	}
+
+	keys := make(StaticKeySet, len(doc.Keys))
+	var lastErr error
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			lastErr = fmt.Errorf("invalid key: '%s' in JWKS document: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("no usable signing keys in JWKS document")
+	}
+	return keys, nil
+}
+
+// publicKey converts the json web key into a key usable by verifySignature
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve: %s", k.Crv)
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+// decodeBigInt decodes a base64url encoded big endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,400 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graze/golang-service/handlers/failure"
+)
+
+// Supported JWT signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// JWT authenticates requests using a signed JSON Web Token supplied in the header: `Authorization: Bearer <token>`
+type JWT struct {
+	// Keys is used to look up the key to verify the signature of a token with
+	Keys KeySet
+	// Algorithms is the list of signing algorithms that are accepted. Defaults to HS256, RS256 and ES256
+	Algorithms []string
+	// Issuer if set must match the `iss` claim of the token
+	Issuer string
+	// Audience if set must be contained in the `aud` claim of the token
+	Audience string
+	// Leeway is the allowed clock skew when checking the `exp` and `nbf` claims
+	Leeway time.Duration
+	// Finder takes the verified *Claims and returns a user object or error if the claims are not valid
+	Finder Finder
+	// OnError gets called if the request is unauthorized or forbidden
+	OnError failure.Handler
+}
+
+// Claims contains the registered claims of a verified token along with the full set of claims in Raw
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	Raw       map[string]interface{}
+}
+
+// HasScope checks if scope is in the space separated `scope` claim or the `scp` claim list
+func (c *Claims) HasScope(scope string) bool {
+	if s, ok := c.Raw["scope"].(string); ok {
+		for _, v := range strings.Fields(s) {
+			if v == scope {
+				return true
+			}
+		}
+	}
+	return listClaimContains(c.Raw["scp"], scope)
+}
+
+// HasRole checks if role is in the `roles` claim
+func (c *Claims) HasRole(role string) bool {
+	return listClaimContains(c.Raw["roles"], role)
+}
+
+// listClaimContains checks if the claim value is either the string value or a list containing it
+func listClaimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		for _, item := range v {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type (
+	// InvalidTokenError if the token is malformed or the signature does not match
+	InvalidTokenError struct{ reason string }
+	// UnsupportedAlgorithmError if the token is signed with an algorithm that is not accepted
+	UnsupportedAlgorithmError struct{ alg string }
+	// UnknownKeyError if the key the token was signed with can not be found
+	UnknownKeyError struct{ kid string }
+	// TokenExpiredError if the `exp` claim of the token is in the past
+	TokenExpiredError struct{ expiry time.Time }
+	// TokenNotValidYetError if the `nbf` claim of the token is in the future
+	TokenNotValidYetError struct{ notBefore time.Time }
+	// InvalidClaimError if a claim does not match the expected value
+	InvalidClaimError struct{ claim, expected string }
+)
+
+func (e *InvalidTokenError) Error() string {
+	return fmt.Sprintf("provided token is not valid: %s", e.reason)
+}
+
+func (e *UnsupportedAlgorithmError) Error() string {
+	return fmt.Sprintf("provided token uses an unsupported algorithm: %s", e.alg)
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("no key found to verify the provided token with. kid: '%s'", e.kid)
+}
+
+func (e *TokenExpiredError) Error() string {
+	return fmt.Sprintf("provided token expired at: %s", e.expiry.Format(time.RFC3339))
+}
+
+func (e *TokenNotValidYetError) Error() string {
+	return fmt.Sprintf("provided token is not valid until: %s", e.notBefore.Format(time.RFC3339))
+}
+
+func (e *InvalidClaimError) Error() string {
+	return fmt.Sprintf("provided token claim: %s does not match. Expecting: %s", e.claim, e.expected)
+}
+
+// ThenFunc wraps a http.HandlerFunc with JWT authentication
+func (j *JWT) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return j.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with JWT authentication
+func (j *JWT) Then(h http.Handler) http.Handler {
+	return j.Handler(h)
+}
+
+// Handler returns a http.Handler that verifies the bearer token of each request and passes the claims to the Finder
+func (j *JWT) Handler(h http.Handler) http.Handler {
+	return authHandler(j, j.OnError, h)
+}
+
+// Authenticate verifies the bearer token of req and returns the user found by the Finder
+func (j *JWT) Authenticate(req *http.Request) (interface{}, error) {
+	header := req.Header["Authorization"]
+	if len(header) == 0 {
+		return nil, &NoHeaderError{}
+	}
+
+	parts := strings.Split(header[0], " ")
+	if !strings.EqualFold(parts[0], "Bearer") {
+		return nil, &BadProviderError{parts[0], "Bearer"}
+	}
+	if len(parts) != 2 {
+		return nil, &InvalidFormatError{"Bearer <token>", header[0]}
+	}
+
+	claims, err := j.Verify(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := j.Finder.Find(claims, req)
+	if err != nil {
+		return nil, &InvalidKeyError{parts[1], err}
+	}
+	return user, nil
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and the time, issuer and audience claims of token and returns the claims
+func (j *JWT) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, &InvalidTokenError{"expecting 3 segments"}
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, &InvalidTokenError{"invalid header: " + err.Error()}
+	}
+	if !j.allowed(header.Alg) {
+		return nil, &UnsupportedAlgorithmError{header.Alg}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, &InvalidTokenError{"invalid signature encoding"}
+	}
+	key, err := j.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, &UnknownKeyError{header.Kid}
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, &InvalidTokenError{"invalid claims: " + err.Error()}
+	}
+	claims, err := parseClaims(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.validate(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// allowed checks if the algorithm alg is accepted
+func (j *JWT) allowed(alg string) bool {
+	algorithms := j.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{HS256, RS256, ES256}
+	}
+	for _, a := range algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the time based claims against now and the issuer and audience claims
+func (j *JWT) validate(c *Claims, now time.Time) error {
+	if !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt.Add(j.Leeway)) {
+		return &TokenExpiredError{c.ExpiresAt}
+	}
+	if !c.NotBefore.IsZero() && now.Add(j.Leeway).Before(c.NotBefore) {
+		return &TokenNotValidYetError{c.NotBefore}
+	}
+	if j.Issuer != "" && c.Issuer != j.Issuer {
+		return &InvalidClaimError{"iss", j.Issuer}
+	}
+	if j.Audience != "" {
+		for _, aud := range c.Audience {
+			if aud == j.Audience {
+				return nil
+			}
+		}
+		return &InvalidClaimError{"aud", j.Audience}
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url encoded json segment of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// verifySignature checks that signature is valid for the signed content using key and the algorithm alg
+func verifySignature(alg string, key interface{}, signed string, signature []byte) error {
+	hash := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return &InvalidTokenError{"key type does not match algorithm: " + alg}
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return &InvalidTokenError{"signature does not match"}
+		}
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return &InvalidTokenError{"key type does not match algorithm: " + alg}
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature); err != nil {
+			return &InvalidTokenError{"signature does not match"}
+		}
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().BitSize != 256 {
+			return &InvalidTokenError{"key type does not match algorithm: " + alg}
+		}
+		if len(signature) != 64 {
+			return &InvalidTokenError{"signature does not match"}
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, hash[:], r, s) {
+			return &InvalidTokenError{"signature does not match"}
+		}
+	default:
+		return &UnsupportedAlgorithmError{alg}
+	}
+	return nil
+}
+
+// parseClaims extracts the registered claims from raw
+func parseClaims(raw map[string]interface{}) (c *Claims, err error) {
+	c = &Claims{Raw: raw}
+	if c.Issuer, err = stringClaim(raw, "iss"); err != nil {
+		return nil, err
+	}
+	if c.Subject, err = stringClaim(raw, "sub"); err != nil {
+		return nil, err
+	}
+	if c.ID, err = stringClaim(raw, "jti"); err != nil {
+		return nil, err
+	}
+	if c.ExpiresAt, err = timeClaim(raw, "exp"); err != nil {
+		return nil, err
+	}
+	if c.NotBefore, err = timeClaim(raw, "nbf"); err != nil {
+		return nil, err
+	}
+	if c.IssuedAt, err = timeClaim(raw, "iat"); err != nil {
+		return nil, err
+	}
+
+	switch aud := raw["aud"].(type) {
+	case nil:
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, &InvalidTokenError{"claim: aud is not a string or list of strings"}
+			}
+			c.Audience = append(c.Audience, s)
+		}
+	default:
+		return nil, &InvalidTokenError{"claim: aud is not a string or list of strings"}
+	}
+	return c, nil
+}
+
+// stringClaim returns the string value of the claim name if it exists
+func stringClaim(raw map[string]interface{}, name string) (string, error) {
+	value, ok := raw[name]
+	if !ok {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", &InvalidTokenError{"claim: " + name + " is not a string"}
+	}
+	return s, nil
+}
+
+// maxNumericDate is the last second of the year 9999, NumericDate claims after it are not valid
+const maxNumericDate = 253402300799
+
+// timeClaim returns the time value of a NumericDate claim name if it exists
+//
+// The value must be a number of seconds between the unix epoch and the end of the year 9999
+func timeClaim(raw map[string]interface{}, name string) (time.Time, error) {
+	value, ok := raw[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, &InvalidTokenError{"claim: " + name + " is not a number"}
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, &InvalidTokenError{"claim: " + name + " is not a number"}
+	}
+	if f < 0 || f > maxNumericDate {
+		return time.Time{}, &InvalidTokenError{"claim: " + name + " is out of range"}
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+}
+
+// NewJWT creates a new JWT authenticator that verifies tokens using keys
+func NewJWT(keys KeySet, finder Finder, onError failure.Handler) *JWT {
+	return &JWT{Keys: keys, Finder: finder, OnError: onError}
+}
@@ -0,0 +1,357 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+// signToken creates a token signed with key using alg
+func signToken(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	hash := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := StaticKeySet{
+		"hs":  secret,
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+	}
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{"sub": "user", "iss": "graze", "aud": "service", "exp": now + 60, "nbf": now - 60}
+
+	cases := map[string]struct {
+		token string
+		err   error
+	}{
+		"hs256": {signToken(t, HS256, "hs", secret, valid), nil},
+		"rs256": {signToken(t, RS256, "rsa", rsaKey, valid), nil},
+		"es256": {signToken(t, ES256, "ec", ecKey, valid), nil},
+		"audience list": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": []string{"other", "service"}}),
+			nil,
+		},
+		"malformed":             {"not.a-token", &InvalidTokenError{}},
+		"bad signature":         {signToken(t, HS256, "hs", []byte("other"), valid), &InvalidTokenError{}},
+		"unknown key":           {signToken(t, HS256, "nope", secret, valid), &UnknownKeyError{}},
+		"unsupported algorithm": {signToken(t, "none", "hs", nil, valid), &UnsupportedAlgorithmError{}},
+		"key algorithm mismatch": {
+			signToken(t, HS256, "rsa", secret, valid),
+			&InvalidTokenError{},
+		},
+		"expired": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "exp": now - 60}),
+			&TokenExpiredError{},
+		},
+		"expired within leeway": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "exp": now - 5}),
+			nil,
+		},
+		"not valid yet": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "nbf": now + 60}),
+			&TokenNotValidYetError{},
+		},
+		"expires far in the future": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "exp": 32503680000}),
+			nil,
+		},
+		"not valid until far in the future": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "nbf": 32503680000}),
+			&TokenNotValidYetError{},
+		},
+		"exp out of range": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "exp": 1e300}),
+			&InvalidTokenError{},
+		},
+		"nbf out of range": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "service", "nbf": json.Number("1e400")}),
+			&InvalidTokenError{},
+		},
+		"wrong issuer": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "other", "aud": "service"}),
+			&InvalidClaimError{},
+		},
+		"wrong audience": {
+			signToken(t, HS256, "hs", secret, map[string]interface{}{"iss": "graze", "aud": "other"}),
+			&InvalidClaimError{},
+		},
+	}
+
+	j := &JWT{Keys: keys, Issuer: "graze", Audience: "service", Leeway: 10 * time.Second}
+
+	for k, tc := range cases {
+		claims, err := j.Verify(tc.token)
+		if tc.err == nil {
+			assert.NoError(t, err, "test: %s", k)
+			if assert.NotNil(t, claims, "test: %s", k) {
+				assert.Equal(t, "graze", claims.Issuer, "test: %s", k)
+			}
+		} else {
+			assert.IsType(t, tc.err, err, "test: %s", k)
+		}
+	}
+}
+
+func TestTimeClaim(t *testing.T) {
+	cases := map[string]struct {
+		value    interface{}
+		expected time.Time
+		valid    bool
+	}{
+		"missing":      {nil, time.Time{}, true},
+		"seconds":      {json.Number("1477648292"), time.Unix(1477648292, 0).UTC(), true},
+		"fraction":     {json.Number("1477648292.5"), time.Unix(1477648292, 500000000).UTC(), true},
+		"year 3000":    {json.Number("32503680000"), time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		"not a number": {"1477648292", time.Time{}, false},
+		"nan":          {json.Number("NaN"), time.Time{}, false},
+		"inf":          {json.Number("+Inf"), time.Time{}, false},
+		"negative":     {json.Number("-1"), time.Time{}, false},
+		"too large":    {json.Number("1e300"), time.Time{}, false},
+		"overflow":     {json.Number("1e400"), time.Time{}, false},
+	}
+
+	for k, tc := range cases {
+		raw := map[string]interface{}{}
+		if tc.value != nil {
+			raw["exp"] = tc.value
+		}
+		value, err := timeClaim(raw, "exp")
+		if tc.valid {
+			assert.NoError(t, err, "test: %s", k)
+			assert.Equal(t, tc.expected, value, "test: %s", k)
+		} else {
+			assert.IsType(t, &InvalidTokenError{}, err, "test: %s", k)
+		}
+	}
+}
+
+func TestJWTAlgorithmRestriction(t *testing.T) {
+	secret := []byte("secret")
+	j := &JWT{Keys: StaticKeySet{"": secret}, Algorithms: []string{RS256}}
+
+	_, err := j.Verify(signToken(t, HS256, "", secret, map[string]interface{}{}))
+	assert.IsType(t, &UnsupportedAlgorithmError{}, err)
+}
+
+func TestJWTAuthErrors(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	token := signToken(t, HS256, "", secret, map[string]interface{}{"sub": "user"})
+
+	cases := map[string]struct {
+		request *http.Request
+		err     error
+		finder  Finder
+	}{
+		"no header": {
+			headerRequest(t, "GET", "/path", map[string]string{}),
+			&NoHeaderError{},
+			FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+				return "", nil
+			}),
+		},
+		"other scheme": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Graze " + token}),
+			&BadProviderError{},
+			FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+				return "", nil
+			}),
+		},
+		"invalid format": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Bearer " + token + " extra"}),
+			&InvalidFormatError{},
+			FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+				return "", nil
+			}),
+		},
+		"invalid token": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Bearer " + token + "a"}),
+			&InvalidTokenError{},
+			FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+				return "", nil
+			}),
+		},
+		"failed finder": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Bearer " + token}),
+			&InvalidKeyError{},
+			FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+				return "", errors.New("some failed error")
+			}),
+		},
+	}
+
+	rec := httptest.NewRecorder()
+
+	for k, tc := range cases {
+		called := false
+		auth := NewJWT(StaticKeySet{"": secret}, tc.finder, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			called = true
+			assert.IsType(t, tc.err, err, "test: %s", k)
+			assert.Equal(t, http.StatusUnauthorized, status, "test: %s", k)
+		}))
+		handler := auth.Then(okHandler)
+		handler.ServeHTTP(rec, tc.request)
+		assert.True(t, called, "test: %s", k)
+	}
+}
+
+func TestValidJWTAuth(t *testing.T) {
+	secret := []byte("secret")
+	token := signToken(t, HS256, "", secret, map[string]interface{}{"sub": "user-1", "scope": "read"})
+
+	finder := FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+		claims, ok := c.(*Claims)
+		assert.True(t, ok)
+		assert.Equal(t, "read", claims.Raw["scope"])
+		return claims.Subject, nil
+	})
+	auth := NewJWT(StaticKeySet{"": secret}, finder, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+		t.Errorf("onError handler called. Err: %s, Status: %d", err, status)
+	}))
+
+	called := false
+	handler := auth.ThenFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		assert.Equal(t, "user-1", GetUser(req))
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), headerRequest(t, "GET", "/stuff", map[string]string{"Authorization": "Bearer " + token}))
+	assert.True(t, called)
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	doc, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": enc(rsaKey.N), "e": enc(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": enc(ecKey.X), "y": enc(ecKey.Y)},
+			{"kty": "oct", "kid": "hs", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": enc(rsaKey.N), "e": enc(big.NewInt(int64(rsaKey.E)))},
+		},
+	})
+
+	keys, err := ParseJWKS(strings.NewReader(string(doc)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, keys, 3)
+	assert.Equal(t, &rsaKey.PublicKey, keys["rsa"])
+	assert.Equal(t, []byte("secret"), keys["hs"])
+
+	j := &JWT{Keys: keys}
+	for kid, key := range map[string]interface{}{"rsa": rsaKey, "ec": ecKey} {
+		alg := RS256
+		if kid == "ec" {
+			alg = ES256
+		}
+		_, err := j.Verify(signToken(t, alg, kid, key, map[string]interface{}{"sub": "user"}))
+		assert.NoError(t, err, "kid: %s", kid)
+	}
+
+	_, err = ParseJWKS(strings.NewReader(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-521","x":"AA","y":"AA"}]}`))
+	assert.Error(t, err)
+
+	_, err = ParseJWKS(strings.NewReader(`{"keys":[{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}]}`))
+	assert.Error(t, err, "no signing keys")
+}
+
+func TestParseJWKSSkipsUnsupportedKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	doc, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "OKP", "kid": "ed", "use": "sig", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AA", "y": "AA"},
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": enc(rsaKey.N), "e": enc(big.NewInt(int64(rsaKey.E)))},
+		},
+	})
+
+	keys, err := ParseJWKS(strings.NewReader(string(doc)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, keys, 1)
+	assert.Equal(t, &rsaKey.PublicKey, keys["rsa"])
+}
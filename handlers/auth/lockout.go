@@ -0,0 +1,253 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/graze/golang-service/handlers"
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/graze/golang-service/log"
+)
+
+// Lockout wraps an Authenticator and temporarily locks out clients that repeatedly supply invalid keys
+//
+// Each InvalidKeyError returned by the Authenticator is counted against the ip of the client (see handlers.GetUserIP)
+// and the first PrefixLength characters of the supplied key (redacted using Redact). Once either reaches Threshold
+// failures within Window it is locked out for Duration, during which requests fail with a *LockedOutError and
+// http.StatusTooManyRequests.
+//
+// The ip and key prefix are checked before authenticating, so a locked out prefix is rejected even if the key is
+// valid. The key is read using Key, or the same way as a wrapped APIKey, XAPIKey, Basic or HMAC authenticator. For
+// other authenticators the prefix is only known once the key has been rejected.
+type Lockout struct {
+	Authenticator Authenticator
+	// Threshold is the number of failures within Window that causes a lockout
+	Threshold int
+	// Window is the period failures are counted over
+	Window time.Duration
+	// Duration is how long a client ip or key prefix is locked out for
+	Duration time.Duration
+	// PrefixLength is the number of characters of the key failures are grouped by, 0 only locks out by client ip
+	PrefixLength int
+	// Key returns the key supplied with a request, or "" if there is none. Defaults to reading the key the same way as
+	// the Authenticator
+	Key func(req *http.Request) string
+	// Logger gets a warning for each lockout
+	Logger log.FieldLogger
+	// OnError gets called if the request is unauthorized or locked out
+	OnError failure.Handler
+
+	mu        sync.Mutex
+	counters  map[string]*failureCounter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// LockedOutError if a client ip or key prefix has too many recent authentication failures
+type LockedOutError struct {
+	subject string
+	until   time.Time
+}
+
+func (e *LockedOutError) Error() string {
+	return fmt.Sprintf("too many failed authentication attempts for %s, locked out until: %s", e.subject, e.until.Format(time.RFC3339))
+}
+
+// failureCounter counts the failures of a single client ip or key prefix
+type failureCounter struct {
+	failures    int
+	start       time.Time
+	lockedUntil time.Time
+}
+
+// ThenFunc wraps a http.HandlerFunc with authentication and lockout
+func (l *Lockout) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return l.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with authentication and lockout
+func (l *Lockout) Then(h http.Handler) http.Handler {
+	return l.Handler(h)
+}
+
+// Handler returns a http.Handler that authenticates each request, responding with http.StatusTooManyRequests and a
+// Retry-After header to clients that are locked out
+func (l *Lockout) Handler(h http.Handler) http.Handler {
+	return authHandler(l, l.OnError, h)
+}
+
+// Authenticate authenticates req using the wrapped Authenticator unless the client is locked out
+func (l *Lockout) Authenticate(req *http.Request) (interface{}, error) {
+	ip := "unknown"
+	if userIP, err := handlers.GetUserIP(req); err == nil {
+		ip = userIP.String()
+	}
+	subjects := []string{"ip:" + ip}
+
+	key := l.key(req)
+	if l.PrefixLength > 0 && key != "" {
+		subjects = append(subjects, l.prefix(key))
+	}
+	for _, subject := range subjects {
+		if err := l.check(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := l.Authenticator.Authenticate(req)
+	keyErr, ok := err.(*InvalidKeyError)
+	if !ok {
+		return user, err
+	}
+
+	if l.PrefixLength > 0 && key == "" && keyErr.key != "" {
+		// the key could not be read before authenticating
+		subjects = append(subjects, l.prefix(keyErr.key))
+		if err := l.check(subjects[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, subject := range subjects {
+		if until, locked := l.fail(subject); locked {
+			logger := l.Logger
+			if logger == nil {
+				logger = log.With(log.KV{"module": "auth.lockout"})
+			}
+			logger.Ctx(req.Context()).With(log.KV{
+				"tag":           "auth_lockout",
+				"lockout.for":   subject,
+				"lockout.until": until.Format(time.RFC3339),
+				"http.user":     ip,
+			}).Err(err).Warnf("locked out %s after %d failed authentication attempts", subject, l.Threshold)
+			return nil, &LockedOutError{subject, until}
+		}
+	}
+	return nil, err
+}
+
+// keySupplier is implemented by Authenticators that can read the key supplied with a request without checking it
+type keySupplier interface {
+	suppliedKey(req *http.Request) string
+}
+
+// key returns the key supplied with req using Key or the Authenticator, or "" if it is not known
+func (l *Lockout) key(req *http.Request) string {
+	if l.Key != nil {
+		return l.Key(req)
+	}
+	if k, ok := l.Authenticator.(keySupplier); ok {
+		return k.suppliedKey(req)
+	}
+	return ""
+}
+
+// prefix returns the lockout subject for the prefix of key
+func (l *Lockout) prefix(key string) string {
+	if len(key) > l.PrefixLength {
+		key = key[:l.PrefixLength]
+	}
+	return "key:" + Redact(key)
+}
+
+// Challenge returns the WWW-Authenticate challenge of the wrapped Authenticator
+func (l *Lockout) Challenge() string {
+	if c, ok := l.Authenticator.(challenger); ok {
+		return c.Challenge()
+	}
+	return ""
+}
+
+// check returns a *LockedOutError if subject is currently locked out
+func (l *Lockout) check(subject string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.counters[subject]; ok && l.clock().Before(c.lockedUntil) {
+		return &LockedOutError{subject, c.lockedUntil}
+	}
+	return nil
+}
+
+// fail records a failure for subject and returns the end of the lockout if it has reached the threshold
+func (l *Lockout) fail(subject string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	if l.counters == nil {
+		l.counters = make(map[string]*failureCounter)
+	}
+	l.sweep(now)
+
+	c, ok := l.counters[subject]
+	if !ok || now.Sub(c.start) > l.Window {
+		c = &failureCounter{start: now}
+		l.counters[subject] = c
+	}
+	c.failures++
+	if c.failures < l.Threshold {
+		return time.Time{}, false
+	}
+
+	c.failures = 0
+	c.start = now
+	c.lockedUntil = now.Add(l.Duration)
+	return c.lockedUntil, true
+}
+
+// clock returns the current time
+func (l *Lockout) clock() time.Time {
+	if l.now == nil {
+		return time.Now()
+	}
+	return l.now()
+}
+
+// sweep removes counters that are no longer counting failures or locked out, at most once per Window
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.Window {
+		return
+	}
+	l.lastSweep = now
+	for subject, c := range l.counters {
+		if now.Sub(c.start) > l.Window && !now.Before(c.lockedUntil) {
+			delete(l.counters, subject)
+		}
+	}
+}
+
+// NewLockout creates a Lockout that locks out a client ip or key prefix for duration after threshold failures
+// within window
+//
+// Failures are grouped by the first 8 characters of the key and logged through the global logger
+//
+// Usage:
+//  keyAuth := auth.NewXAPIKey(auth.FinderFunc(finder), nil)
+//  lockout := auth.NewLockout(keyAuth, 10, time.Minute, 15*time.Minute, failure.HandlerFunc(onError))
+//
+//  http.Handle("/", lockout.Then(router))
+func NewLockout(a Authenticator, threshold int, window, duration time.Duration, onError failure.Handler) *Lockout {
+	return &Lockout{
+		Authenticator: a,
+		Threshold:     threshold,
+		Window:        window,
+		Duration:      duration,
+		PrefixLength:  8,
+		Logger:        log.With(log.KV{"module": "auth.lockout"}),
+		OnError:       onError,
+		counters:      make(map[string]*failureCounter),
+		now:           time.Now,
+	}
+}
@@ -0,0 +1,226 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/graze/golang-service/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func lockoutRequest(t *testing.T, ip, key string) *http.Request {
+	req := headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": key})
+	req.RemoteAddr = ip + ":1234"
+	return req
+}
+
+func forwardedRequest(t *testing.T, key, forwardedFor string) *http.Request {
+	req := lockoutRequest(t, "10.0.0.100", key)
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	return req
+}
+
+func TestLockout(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		first    []*http.Request
+		request  *http.Request
+		status   int
+		lockedBy string
+	}{
+		"valid key": {
+			[]*http.Request{},
+			lockoutRequest(t, "10.0.0.1", "key"),
+			http.StatusOK,
+			"",
+		},
+		"below threshold": {
+			[]*http.Request{lockoutRequest(t, "10.0.0.1", "wrong-1")},
+			lockoutRequest(t, "10.0.0.1", "wrong-2"),
+			http.StatusUnauthorized,
+			"",
+		},
+		"ip reaching threshold": {
+			[]*http.Request{lockoutRequest(t, "10.0.0.1", "aaaa"), lockoutRequest(t, "10.0.0.1", "bbbb")},
+			lockoutRequest(t, "10.0.0.1", "cccc"),
+			http.StatusTooManyRequests,
+			"ip:10.0.0.1",
+		},
+		"locked out ip with valid key": {
+			[]*http.Request{lockoutRequest(t, "10.0.0.1", "aaaa"), lockoutRequest(t, "10.0.0.1", "bbbb"), lockoutRequest(t, "10.0.0.1", "cccc")},
+			lockoutRequest(t, "10.0.0.1", "key"),
+			http.StatusTooManyRequests,
+			"ip:10.0.0.1",
+		},
+		"forwarded ip": {
+			[]*http.Request{
+				forwardedRequest(t, "aaaa", "203.0.113.9, 10.0.0.1"),
+				forwardedRequest(t, "bbbb", "203.0.113.9, 10.0.0.2"),
+			},
+			forwardedRequest(t, "cccc", "203.0.113.9"),
+			http.StatusTooManyRequests,
+			"ip:203.0.113.9",
+		},
+		"key prefix across ips": {
+			[]*http.Request{lockoutRequest(t, "10.0.0.1", "prefix-1"), lockoutRequest(t, "10.0.0.2", "prefix-2")},
+			lockoutRequest(t, "10.0.0.3", "prefix-3"),
+			http.StatusTooManyRequests,
+			"key:" + Redact("prefix"),
+		},
+		"different ips and prefixes": {
+			[]*http.Request{lockoutRequest(t, "10.0.0.1", "aaaa"), lockoutRequest(t, "10.0.0.2", "bbbb")},
+			lockoutRequest(t, "10.0.0.3", "cccc"),
+			http.StatusUnauthorized,
+			"",
+		},
+	}
+
+	for k, tc := range cases {
+		var lockErr error
+		lockout := NewLockout(NewXAPIKey(keyFinder, nil), 3, time.Minute, time.Minute, failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			lockErr = err
+			w.WriteHeader(status)
+		}))
+		lockout.PrefixLength = 6
+		lockout.Logger = log.New("", "", "")
+		handler := lockout.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "key user", GetUser(r), "test: %s", k)
+		})
+
+		for _, req := range tc.first {
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, tc.request)
+
+		assert.Equal(t, tc.status, rec.Code, "test: %s", k)
+		if tc.lockedBy != "" {
+			assert.IsType(t, &LockedOutError{}, lockErr, "test: %s", k)
+			assert.Equal(t, tc.lockedBy, lockErr.(*LockedOutError).subject, "test: %s", k)
+			assert.Equal(t, "60", rec.Header().Get("Retry-After"), "test: %s", k)
+		} else {
+			assert.Equal(t, "", rec.Header().Get("Retry-After"), "test: %s", k)
+		}
+	}
+}
+
+func TestLockoutRejectsValidKeysWithALockedPrefix(t *testing.T) {
+	cases := map[string]struct {
+		authenticator Authenticator
+		request       func(ip, key string) *http.Request
+	}{
+		"x-api-key": {
+			NewXAPIKey(keyFinder, nil),
+			func(ip, key string) *http.Request { return lockoutRequest(t, ip, key) },
+		},
+		"api key": {
+			NewAPIKey("Graze", keyFinder, nil),
+			func(ip, key string) *http.Request {
+				req := headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Graze " + key})
+				req.RemoteAddr = ip + ":1234"
+				return req
+			},
+		},
+		"first of": {
+			FirstOf(nil, Scheme{"api-key", NewXAPIKey(keyFinder, nil)}),
+			func(ip, key string) *http.Request { return lockoutRequest(t, ip, key) },
+		},
+	}
+
+	for k, tc := range cases {
+		calls := 0
+		lockout := NewLockout(tc.authenticator, 3, time.Minute, time.Minute, nil)
+		lockout.PrefixLength = 3
+		lockout.Logger = log.New("", "", "")
+		lockout.Authenticator = authenticatorFunc(func(req *http.Request) (interface{}, error) {
+			calls++
+			return tc.authenticator.Authenticate(req)
+		})
+		lockout.Key = tc.authenticator.(keySupplier).suppliedKey
+
+		for i, key := range []string{"key-1", "key-2", "key-3"} {
+			lockout.Authenticate(tc.request("10.0.1."+string('1'+rune(i)), key))
+		}
+		calls = 0
+
+		_, err := lockout.Authenticate(tc.request("10.0.1.9", "key"))
+		assert.IsType(t, &LockedOutError{}, err, "test: %s", k)
+		assert.Equal(t, 0, calls, "test: %s - the key is not checked while the prefix is locked out", k)
+	}
+}
+
+// authenticatorFunc converts a function into an Authenticator
+type authenticatorFunc func(req *http.Request) (interface{}, error)
+
+func (f authenticatorFunc) Authenticate(req *http.Request) (interface{}, error) {
+	return f(req)
+}
+
+func TestLockoutReadsTheKeyOfTheAuthenticator(t *testing.T) {
+	lockout := NewLockout(NewXAPIKey(keyFinder, nil), 3, time.Minute, time.Minute, nil)
+	lockout.PrefixLength = 3
+	lockout.Logger = log.New("", "", "")
+
+	for i, key := range []string{"key-1", "key-2", "key-3"} {
+		lockout.Authenticate(lockoutRequest(t, "10.0.2."+string('1'+rune(i)), key))
+	}
+	_, err := lockout.Authenticate(lockoutRequest(t, "10.0.2.9", "key"))
+	if assert.IsType(t, &LockedOutError{}, err) {
+		assert.Equal(t, "key:"+Redact("key"), err.(*LockedOutError).subject)
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	now := time.Now()
+	lockout := NewLockout(NewXAPIKey(keyFinder, nil), 2, time.Minute, 5*time.Minute, nil)
+	lockout.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		lockout.Authenticate(lockoutRequest(t, "10.0.0.1", "wrong"))
+	}
+	_, err := lockout.Authenticate(lockoutRequest(t, "10.0.0.1", "key"))
+	assert.IsType(t, &LockedOutError{}, err)
+
+	now = now.Add(5 * time.Minute)
+	user, err := lockout.Authenticate(lockoutRequest(t, "10.0.0.1", "key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "key user", user)
+
+	// failures outside of the window do not count
+	lockout.Authenticate(lockoutRequest(t, "10.0.0.2", "wrong"))
+	now = now.Add(2 * time.Minute)
+	_, err = lockout.Authenticate(lockoutRequest(t, "10.0.0.2", "other"))
+	assert.IsType(t, &InvalidKeyError{}, err)
+}
+
+func TestLockoutLogsLockouts(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	lockout := NewLockout(NewXAPIKey(keyFinder, nil), 1, time.Minute, time.Minute, nil)
+	lockout.Logger = logger.With(log.KV{"module": "auth.lockout"})
+	lockout.Authenticate(lockoutRequest(t, "10.0.0.1", "wrong-key"))
+
+	assert.Equal(t, 1, len(hook.Entries))
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, "auth_lockout", hook.LastEntry().Data["tag"])
+	assert.Equal(t, "ip:10.0.0.1", hook.LastEntry().Data["lockout.for"])
+	assert.Equal(t, "10.0.0.1", hook.LastEntry().Data["http.user"])
+	assert.Equal(t, "auth.lockout", hook.LastEntry().Data["module"])
+}
@@ -0,0 +1,154 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/graze/golang-service/handlers/failure"
+)
+
+// Scheme is a named Authenticator used by Multi
+type Scheme struct {
+	// Name is stored in the request context when this scheme authenticates a request. See GetScheme
+	Name          string
+	Authenticator Authenticator
+}
+
+// Multi authenticates requests using a list of schemes
+//
+// By default the schemes are tried in order and the first scheme that has credentials supplied is used. If those
+// credentials are invalid the request fails without trying the remaining schemes.
+// If RequireAll is set every scheme must authenticate the request.
+type Multi struct {
+	Schemes []Scheme
+	// RequireAll requires every scheme to authenticate the request
+	RequireAll bool
+	// OnError gets called if the request is unauthorized or forbidden
+	OnError failure.Handler
+}
+
+// NoCredentialsError if none of the schemes of a Multi have credentials supplied
+type NoCredentialsError struct{ schemes []string }
+
+func (e *NoCredentialsError) Error() string {
+	return fmt.Sprintf("no credentials provided for any of the authentication schemes: %s", strings.Join(e.schemes, ", "))
+}
+
+// ThenFunc wraps a http.HandlerFunc with multi scheme authentication
+func (m *Multi) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return m.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with multi scheme authentication
+func (m *Multi) Then(h http.Handler) http.Handler {
+	return m.Handler(h)
+}
+
+// Handler returns a http.Handler that authenticates each request and stores the user and the name of the scheme that
+// authenticated it in the request context
+func (m *Multi) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		scheme, user, err := m.authenticate(req)
+		if err != nil {
+			challenge(w, m)
+			m.OnError.Handle(w, req, err, failureStatus(w, err))
+			return
+		}
+		req = saveScheme(saveUser(req, user), scheme)
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Authenticate authenticates req using the schemes and returns the user
+func (m *Multi) Authenticate(req *http.Request) (interface{}, error) {
+	_, user, err := m.authenticate(req)
+	return user, err
+}
+
+// authenticate returns the name of the scheme and the user that authenticated req
+//
+// When RequireAll is set the user is from the first scheme and the scheme names are joined with a `+`
+func (m *Multi) authenticate(req *http.Request) (string, interface{}, error) {
+	if m.RequireAll {
+		var (
+			user  interface{}
+			names []string
+		)
+		for i, s := range m.Schemes {
+			u, err := s.Authenticator.Authenticate(req)
+			if err != nil {
+				return "", nil, err
+			}
+			if i == 0 {
+				user = u
+			}
+			names = append(names, s.Name)
+		}
+		return strings.Join(names, "+"), user, nil
+	}
+
+	names := make([]string, 0, len(m.Schemes))
+	for _, s := range m.Schemes {
+		user, err := s.Authenticator.Authenticate(req)
+		if err == nil {
+			return s.Name, user, nil
+		}
+		if !IsMissingCredentials(err) {
+			return "", nil, err
+		}
+		names = append(names, s.Name)
+	}
+	return "", nil, &NoCredentialsError{names}
+}
+
+// suppliedKey returns the first key supplied to any of the schemes, or "" if there is none
+func (m *Multi) suppliedKey(req *http.Request) string {
+	for _, s := range m.Schemes {
+		if k, ok := s.Authenticator.(keySupplier); ok {
+			if key := k.suppliedKey(req); key != "" {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// Challenge returns the WWW-Authenticate challenges of each scheme that has one
+func (m *Multi) Challenge() string {
+	var challenges []string
+	for _, s := range m.Schemes {
+		if c, ok := s.Authenticator.(challenger); ok && c.Challenge() != "" {
+			challenges = append(challenges, c.Challenge())
+		}
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// FirstOf creates a Multi that authenticates a request using the first scheme that has credentials supplied
+//
+// Usage:
+//  keyAuth := auth.FirstOf(failure.HandlerFunc(onError),
+//      auth.Scheme{"x-api-key", auth.NewXAPIKey(finder, nil)},
+//      auth.Scheme{"graze", auth.NewAPIKey("Graze", finder, nil)},
+//  )
+//  http.Handle("/", keyAuth.Then(router))
+func FirstOf(onError failure.Handler, schemes ...Scheme) *Multi {
+	return &Multi{Schemes: schemes, OnError: onError}
+}
+
+// AllOf creates a Multi that requires every scheme to authenticate a request
+func AllOf(onError failure.Handler, schemes ...Scheme) *Multi {
+	return &Multi{Schemes: schemes, RequireAll: true, OnError: onError}
+}
@@ -0,0 +1,156 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+var keyFinder = FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+	if c == "key" {
+		return "key user", nil
+	}
+	return nil, errors.New("unknown key")
+})
+
+func TestFirstOf(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		request *http.Request
+		user    interface{}
+		scheme  string
+		err     error
+	}{
+		"x-api-key": {
+			headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": "key"}),
+			"key user",
+			"x-api-key",
+			nil,
+		},
+		"authorization": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Graze key"}),
+			"key user",
+			"graze",
+			nil,
+		},
+		"basic": {
+			basicRequest(t, "admin", "secret"),
+			"admin",
+			"basic",
+			nil,
+		},
+		"first scheme with credentials wins": {
+			headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": "key", "Authorization": "Graze other"}),
+			"key user",
+			"x-api-key",
+			nil,
+		},
+		"invalid credentials do not fall through": {
+			headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": "other", "Authorization": "Graze key"}),
+			nil,
+			"",
+			&InvalidKeyError{},
+		},
+		"no credentials": {
+			headerRequest(t, "GET", "/path", map[string]string{}),
+			nil,
+			"",
+			&NoCredentialsError{},
+		},
+		"unknown scheme": {
+			headerRequest(t, "GET", "/path", map[string]string{"Authorization": "Fish cake"}),
+			nil,
+			"",
+			&NoCredentialsError{},
+		},
+	}
+
+	for k, tc := range cases {
+		called := false
+		auth := FirstOf(
+			failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+				called = true
+				assert.IsType(t, tc.err, err, "test: %s", k)
+				assert.Equal(t, http.StatusUnauthorized, status, "test: %s", k)
+			}),
+			Scheme{"x-api-key", NewXAPIKey(keyFinder, nil)},
+			Scheme{"graze", NewAPIKey("Graze", keyFinder, nil)},
+			Scheme{"basic", NewBasic("admin", BasicUsers{"admin": "secret"}, nil)},
+		)
+		rec := httptest.NewRecorder()
+		auth.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			assert.Nil(t, tc.err, "test: %s", k)
+			assert.Equal(t, tc.user, GetUser(r), "test: %s", k)
+			assert.Equal(t, tc.scheme, GetScheme(r), "test: %s", k)
+		}).ServeHTTP(rec, tc.request)
+		assert.True(t, called, "test: %s", k)
+		if tc.err != nil {
+			assert.Equal(t, `Basic realm="admin"`, rec.Header().Get("WWW-Authenticate"), "test: %s", k)
+		}
+	}
+}
+
+func TestAllOf(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		request *http.Request
+		err     error
+	}{
+		"all pass": {
+			headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": "key", "Authorization": "Graze key"}),
+			nil,
+		},
+		"one missing": {
+			headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": "key"}),
+			&NoHeaderError{},
+		},
+		"one invalid": {
+			headerRequest(t, "GET", "/path", map[string]string{"X-Api-Key": "key", "Authorization": "Graze other"}),
+			&InvalidKeyError{},
+		},
+	}
+
+	for k, tc := range cases {
+		called := false
+		auth := AllOf(
+			failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+				called = true
+				assert.IsType(t, tc.err, err, "test: %s", k)
+			}),
+			Scheme{"x-api-key", NewXAPIKey(keyFinder, nil)},
+			Scheme{"graze", NewAPIKey("Graze", keyFinder, nil)},
+		)
+		auth.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			assert.Nil(t, tc.err, "test: %s", k)
+			assert.Equal(t, "key user", GetUser(r), "test: %s", k)
+			assert.Equal(t, "x-api-key+graze", GetScheme(r), "test: %s", k)
+		}).ServeHTTP(httptest.NewRecorder(), tc.request)
+		assert.True(t, called, "test: %s", k)
+	}
+}
+
+func TestIsMissingCredentials(t *testing.T) {
+	assert.True(t, IsMissingCredentials(&NoHeaderError{}))
+	assert.True(t, IsMissingCredentials(&BadProviderError{}))
+	assert.False(t, IsMissingCredentials(&InvalidFormatError{}))
+	assert.False(t, IsMissingCredentials(&InvalidKeyError{}))
+	assert.False(t, IsMissingCredentials(errors.New("some error")))
+}
@@ -0,0 +1,57 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Redactor converts a supplied key or header into a form that is safe to include in error messages and logs
+type Redactor func(value string) string
+
+// Redact is the Redactor used by the authentication errors, by default keys are shown as a Fingerprint
+//
+// Usage:
+//  auth.Redact = auth.Truncate(4)
+var Redact Redactor = Fingerprint
+
+// Fingerprint returns a short hash of value that can be used to match up failures without revealing the value
+//
+//  auth.Fingerprint("some-api-key") // sha256:1b2f3e4d
+func Fingerprint(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// Truncate creates a Redactor that shows the first n characters of value followed by `...`
+//
+// Values of n characters or fewer are replaced entirely so short keys are never shown in full
+func Truncate(n int) Redactor {
+	return func(value string) string {
+		if len(value) <= n {
+			return "..."
+		}
+		return value[:n] + "..."
+	}
+}
+
+// redactHeader redacts an Authorization style header keeping the scheme: `<scheme> <credentials>`
+func redactHeader(header string) string {
+	if i := strings.Index(header, " "); i > 0 {
+		return header[:i] + " " + Redact(header[i+1:])
+	}
+	return Redact(header)
+}
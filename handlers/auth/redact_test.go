@@ -0,0 +1,101 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactors(t *testing.T) {
+	cases := map[string]struct {
+		redactor Redactor
+		value    string
+		expected string
+	}{
+		"fingerprint":          {Fingerprint, "some-api-key", Fingerprint("some-api-key")},
+		"fingerprint empty":    {Fingerprint, "", ""},
+		"truncate":             {Truncate(4), "some-api-key", "some..."},
+		"truncate short value": {Truncate(4), "some", "..."},
+	}
+
+	for k, tc := range cases {
+		assert.Equal(t, tc.expected, tc.redactor(tc.value), "test: %s", k)
+	}
+
+	assert.Regexp(t, "^sha256:[0-9a-f]{8}$", Fingerprint("some-api-key"))
+	assert.NotEqual(t, Fingerprint("some-api-key"), Fingerprint("other-api-key"))
+}
+
+func TestErrorsDoNotContainKeys(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected string
+	}{
+		"invalid key": {
+			&InvalidKeyError{"secret-key", errors.New("unknown")},
+			"provided api key: '" + Fingerprint("secret-key") + "' is not valid: unknown",
+		},
+		"finder error containing the key": {
+			&InvalidKeyError{"secret-key", errors.New("No user found for: secret-key")},
+			"provided api key: '" + Fingerprint("secret-key") + "' is not valid: No user found for: " + Fingerprint("secret-key"),
+		},
+		"invalid format": {
+			&InvalidFormatError{"<provider> <apiKey>", "Graze secret key"},
+			"provided Authorization header in invalid format, expecting: <provider> <apiKey> got: Graze " + Fingerprint("secret key"),
+		},
+		"invalid format without scheme": {
+			&InvalidFormatError{"<provider> <apiKey>", "secret-key"},
+			"provided Authorization header in invalid format, expecting: <provider> <apiKey> got: " + Fingerprint("secret-key"),
+		},
+		"bad provider": {
+			&BadProviderError{"secret-key", "Bearer"},
+			"Authroziation provider does not match. Expecting: Bearer got: " + Fingerprint("secret-key"),
+		},
+	}
+
+	for k, tc := range cases {
+		assert.Equal(t, tc.expected, tc.err.Error(), "test: %s", k)
+		assert.NotContains(t, tc.err.Error(), "secret", "test: %s", k)
+	}
+}
+
+func TestBareKeyHeadersDoNotLeakKeys(t *testing.T) {
+	cases := map[string]Authenticator{
+		"api key": NewAPIKey("Graze", keyFinder, nil),
+		"basic":   NewBasic("realm", keyFinder, nil),
+		"jwt":     NewJWT(StaticKeySet{}, keyFinder, nil),
+		"hmac":    NewHMAC("Graze", keyFinder, nil),
+	}
+
+	for k, authenticator := range cases {
+		_, err := authenticator.Authenticate(headerRequest(t, "GET", "/", map[string]string{"Authorization": "secret-key"}))
+		if assert.Error(t, err, "test: %s", k) {
+			assert.NotContains(t, err.Error(), "secret-key", "test: %s", k)
+		}
+	}
+}
+
+func TestFinderErrorsDoNotLeakKeys(t *testing.T) {
+	finder := FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+		return nil, fmt.Errorf("No user found for: %s", c)
+	})
+
+	_, err := NewXAPIKey(finder, nil).Authenticate(headerRequest(t, "GET", "/", map[string]string{"X-Api-Key": "secret-key"}))
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "secret-key")
+		assert.Contains(t, err.Error(), Fingerprint("secret-key"))
+	}
+}
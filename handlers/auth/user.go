@@ -13,13 +13,18 @@ package auth
 import (
 	"context"
 	"net/http"
+	"reflect"
 )
 
 // contextKey is a custom type to only allow this to access the key in the context
 type contextKey int
 
-// userKey is a private key to store the user information in the context in
-const userKey contextKey = iota
+const (
+	// userKey is a private key to store the user information in the context in
+	userKey contextKey = iota
+	// schemeKey is a private key to store the name of the authentication scheme in the context in
+	schemeKey
+)
 
 // saveUser takes a nominal user and stores it in a new context for the provided request
 func saveUser(r *http.Request, user interface{}) *http.Request {
@@ -50,3 +55,55 @@ func saveUser(r *http.Request, user interface{}) *http.Request {
 func GetUser(r *http.Request) interface{} {
 	return r.Context().Value(userKey)
 }
+
+// UserAs finds the user stored in the request and, if it can be assigned to the value pointed to by target, sets
+// target to the user and returns true
+//
+// target must be a non-nil pointer, otherwise UserAs panics
+//
+// Usage:
+// 	func ItemHandler(w http.ResponseWriter, r *http.Request) {
+// 		var user *User
+// 		if !auth.UserAs(r, &user) {
+// 			w.WriteHeader(403)
+// 			return
+// 		}
+// 		...
+// 	}
+func UserAs(r *http.Request, target interface{}) bool {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		panic("auth: UserAs target must be a non-nil pointer")
+	}
+
+	user := GetUser(r)
+	if user == nil || !reflect.TypeOf(user).AssignableTo(value.Type().Elem()) {
+		return false
+	}
+	value.Elem().Set(reflect.ValueOf(user))
+	return true
+}
+
+// saveScheme stores the name of the authentication scheme used in a new context for the provided request
+func saveScheme(r *http.Request, scheme string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), schemeKey, scheme))
+}
+
+// GetScheme retrieves the name of the scheme that authenticated the request when using FirstOf or AllOf
+//
+// Usage:
+// 	keyAuth := auth.FirstOf(onError,
+// 		auth.Scheme{"x-api-key", auth.NewXAPIKey(finder, nil)},
+// 		auth.Scheme{"graze", auth.NewAPIKey("Graze", finder, nil)},
+// 	)
+//
+// 	func ItemHandler(w http.ResponseWriter, r *http.Request) {
+// 		if auth.GetScheme(r) == "graze" {
+// 			log.Ctx(r.Context()).Warn("deprecated Authorization header used")
+// 		}
+// 		...
+// 	}
+func GetScheme(r *http.Request) string {
+	scheme, _ := r.Context().Value(schemeKey).(string)
+	return scheme
+}
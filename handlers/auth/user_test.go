@@ -66,3 +66,26 @@ func TestUserStorage(t *testing.T) {
 		handler.ServeHTTP(rec, tc.request)
 	}
 }
+
+func TestUserAs(t *testing.T) {
+	user := &testUser{roles: []string{"admin"}}
+	req := saveUser(headerRequest(t, "GET", "/stuff", map[string]string{}), user)
+
+	var found *testUser
+	assert.True(t, UserAs(req, &found))
+	assert.Equal(t, user, found)
+
+	var holder RoleHolder
+	assert.True(t, UserAs(req, &holder), "can be assigned to an interface")
+	assert.True(t, holder.HasRole("admin"))
+
+	var wrong string
+	assert.False(t, UserAs(req, &wrong))
+	assert.Equal(t, "", wrong)
+
+	var none *testUser
+	assert.False(t, UserAs(headerRequest(t, "GET", "/stuff", map[string]string{}), &none))
+	assert.Nil(t, none)
+
+	assert.Panics(t, func() { UserAs(req, "not a pointer") })
+}
@@ -37,7 +37,7 @@ type XAPIKey struct {
 // 		}
 // 		user, ok := users[key]
 // 		if !ok {
-// 			return nil, fmt.Errorf("No user found for: %s", key)
+// 			return nil, fmt.Errorf("No user found")
 // 		}
 // 		return user, nil
 // 	}
@@ -64,7 +64,7 @@ func (x *XAPIKey) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Han
 // 		}
 // 		user, ok := users[key]
 // 		if !ok {
-// 			return nil, fmt.Errorf("No user found for: %s", key)
+// 			return nil, fmt.Errorf("No user found")
 // 		}
 // 		return user, nil
 // 	}
@@ -83,22 +83,26 @@ func (x *XAPIKey) Then(h http.Handler) http.Handler {
 
 // Handler wraps the Then method to become clearer
 func (x *XAPIKey) Handler(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		header := req.Header["X-Api-Key"]
-		if len(header) == 0 {
-			x.OnError.Handle(w, req, &NoHeaderError{}, http.StatusUnauthorized)
-			return
-		}
+	return authHandler(x, x.OnError, h)
+}
+
+// Authenticate checks the X-Api-Key header of req and returns the user found by the Finder
+func (x *XAPIKey) Authenticate(req *http.Request) (interface{}, error) {
+	header := req.Header["X-Api-Key"]
+	if len(header) == 0 {
+		return nil, &NoHeaderError{}
+	}
 
-		user, err := x.Finder.Find(header[0], req)
-		if err != nil {
-			x.OnError.Handle(w, req, &InvalidKeyError{header[0], err}, http.StatusUnauthorized)
-			return
-		}
-		req = saveUser(req, user)
+	user, err := x.Finder.Find(header[0], req)
+	if err != nil {
+		return nil, &InvalidKeyError{header[0], err}
+	}
+	return user, nil
+}
 
-		h.ServeHTTP(w, req)
-	})
+// suppliedKey returns the api key in the X-Api-Key header of req
+func (x *XAPIKey) suppliedKey(req *http.Request) string {
+	return req.Header.Get("X-Api-Key")
 }
 
 // NewXAPIKey returns an APIKey struct that has a Handle method to provide authentication to your service
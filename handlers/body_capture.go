@@ -0,0 +1,286 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/graze/golang-service/log"
+)
+
+// DefaultBodyCaptureLimit is the default maximum number of bytes of each body that is logged
+const DefaultBodyCaptureLimit = 4096
+
+var (
+	// DefaultBodyContentTypes are the content types of the bodies that are logged by default. Types ending in / match
+	// any sub type
+	DefaultBodyContentTypes = []string{"application/json", "application/xml", "application/x-www-form-urlencoded", "text/"}
+	// DefaultDeniedHeaders are the headers that are not logged by default
+	DefaultDeniedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	// DefaultRedactedFields are the JSON and form fields whose values are redacted by default
+	DefaultRedactedFields = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret"}
+)
+
+// Redacted replaces the value of a redacted field
+const Redacted = "[REDACTED]"
+
+// StatusRange is an inclusive range of response statuses
+type StatusRange struct {
+	Min, Max int
+}
+
+// BodyCapture configures the logging of request and response bodies and headers by the structured log handler
+//
+// Bodies are only read as the handler reads the request and writes the response, so streaming and Flush still work.
+type BodyCapture struct {
+	// Request logs the request body as http.request.body
+	Request bool
+	// Response logs the response body as http.response.body
+	Response bool
+	// MaxBytes is the maximum number of bytes of each body logged. Defaults to DefaultBodyCaptureLimit
+	MaxBytes int
+	// ContentTypes are the content types of the bodies logged. Defaults to DefaultBodyContentTypes
+	ContentTypes []string
+	// Statuses are the response statuses that bodies and headers are logged for. Defaults to all statuses
+	Statuses []StatusRange
+	// Headers logs the request and response headers as http.request.headers and http.response.headers
+	Headers bool
+	// AllowedHeaders are the only headers logged, if set
+	AllowedHeaders []string
+	// DeniedHeaders are never logged. Defaults to DefaultDeniedHeaders
+	DeniedHeaders []string
+	// Redact are the JSON and form fields with values replaced by Redacted. Defaults to DefaultRedactedFields
+	Redact []string
+
+	once   sync.Once
+	fields []*regexp.Regexp
+}
+
+// capturedBodies holds the bodies captured for a single request
+type capturedBodies struct {
+	capture  *BodyCapture
+	req      *http.Request
+	request  *captureReader
+	response *captureResponseWriter
+}
+
+// capture returns the response writer and request to pass to the handler in place of w and req
+func (c *BodyCapture) capture(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, *http.Request, *capturedBodies) {
+	bodies := &capturedBodies{capture: c, req: req}
+	if c.Request && req.Body != nil && c.matchesContentType(req.Header.Get("Content-Type")) {
+		bodies.request = &captureReader{ReadCloser: req.Body, limit: c.limit()}
+		r := new(http.Request)
+		*r = *req
+		r.Body = bodies.request
+		req = r
+	}
+	if c.Response {
+		w, bodies.response = makeCaptureWriter(MakeLogger(w), c)
+	}
+	return w, req, bodies
+}
+
+// limit returns the maximum number of bytes of a body to log
+func (c *BodyCapture) limit() int {
+	if c.MaxBytes > 0 {
+		return c.MaxBytes
+	}
+	return DefaultBodyCaptureLimit
+}
+
+// matchesContentType returns true if bodies with contentType should be logged
+func (c *BodyCapture) matchesContentType(contentType string) bool {
+	types := c.ContentTypes
+	if types == nil {
+		types = DefaultBodyContentTypes
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesStatus returns true if bodies should be logged for responses with status
+func (c *BodyCapture) matchesStatus(status int) bool {
+	if len(c.Statuses) == 0 {
+		return true
+	}
+	for _, r := range c.Statuses {
+		if status >= r.Min && status <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// headers returns the headers that are allowed to be logged
+func (c *BodyCapture) headers(header http.Header) map[string]string {
+	denied := c.DeniedHeaders
+	if denied == nil {
+		denied = DefaultDeniedHeaders
+	}
+	values := make(map[string]string)
+	for name, value := range header {
+		if c.AllowedHeaders != nil && !containsHeader(c.AllowedHeaders, name) || containsHeader(denied, name) {
+			continue
+		}
+		values[name] = strings.Join(value, ", ")
+	}
+	return values
+}
+
+// containsHeader returns true if name is in headers, ignoring case
+func containsHeader(headers []string, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces the values of the redacted JSON and form fields in body
+//
+// Regular expressions are used rather than decoding the body so that truncated and invalid bodies are also redacted
+func (c *BodyCapture) redact(body string) string {
+	c.once.Do(func() {
+		fields := c.Redact
+		if fields == nil {
+			fields = DefaultRedactedFields
+		}
+		if len(fields) == 0 {
+			return
+		}
+		quoted := make([]string, len(fields))
+		for i, f := range fields {
+			quoted[i] = regexp.QuoteMeta(f)
+		}
+		names := strings.Join(quoted, "|")
+		c.fields = []*regexp.Regexp{
+			regexp.MustCompile(`(?i)("(?:` + names + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`),
+			regexp.MustCompile(`(?i)((?:^|&)(?:` + names + `)=)[^&]*`),
+		}
+	})
+	if len(c.fields) == 2 {
+		body = c.fields[0].ReplaceAllString(body, `${1}"`+Redacted+`"`)
+		body = c.fields[1].ReplaceAllString(body, `${1}`+Redacted)
+	}
+	return body
+}
+
+// fields returns the log fields for the captured bodies of a response with status
+func (b *capturedBodies) fields(w http.ResponseWriter, status int) log.KV {
+	fields := log.KV{}
+	if b == nil || !b.capture.matchesStatus(status) {
+		return fields
+	}
+	if b.capture.Headers {
+		fields["http.request.headers"] = b.capture.headers(b.req.Header)
+		fields["http.response.headers"] = b.capture.headers(w.Header())
+	}
+	if b.request != nil {
+		fields["http.request.body"] = b.capture.redact(b.request.body.String())
+		if b.request.truncated {
+			fields["http.request.truncated"] = true
+		}
+	}
+	if b.response != nil && b.response.enabled {
+		fields["http.response.body"] = b.capture.redact(b.response.body.String())
+		if b.response.truncated {
+			fields["http.response.truncated"] = true
+		}
+	}
+	return fields
+}
+
+// captureReader keeps a copy of the start of the body read through it
+type captureReader struct {
+	io.ReadCloser
+	limit     int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.truncated = capture(&r.body, p[:n], r.limit) || r.truncated
+	return n, err
+}
+
+// captureResponseWriter keeps a copy of the start of the response body if it has a captured content type
+type captureResponseWriter struct {
+	LoggingResponseWriter
+	capture   *BodyCapture
+	body      bytes.Buffer
+	checked   bool
+	enabled   bool
+	truncated bool
+}
+
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	if !w.checked {
+		w.checked = true
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(b)
+		}
+		w.enabled = w.capture.matchesContentType(contentType)
+	}
+	n, err := w.LoggingResponseWriter.Write(b)
+	if w.enabled {
+		w.truncated = capture(&w.body, b[:n], w.capture.limit()) || w.truncated
+	}
+	return n, err
+}
+
+// capture appends b to buf up to limit bytes, returning true if any of b was not appended
+func capture(buf *bytes.Buffer, b []byte, limit int) bool {
+	remaining := limit - buf.Len()
+	if remaining <= 0 {
+		return len(b) > 0
+	}
+	if len(b) > remaining {
+		buf.Write(b[:remaining])
+		return true
+	}
+	buf.Write(b)
+	return false
+}
+
+type hijackWriter struct {
+	LoggingResponseWriter
+	http.Hijacker
+}
+
+// makeCaptureWriter wraps w in a captureResponseWriter keeping the http.Hijacker and http.CloseNotifier interfaces of w
+func makeCaptureWriter(w LoggingResponseWriter, c *BodyCapture) (LoggingResponseWriter, *captureResponseWriter) {
+	cw := &captureResponseWriter{LoggingResponseWriter: w, capture: c}
+	h, ok1 := w.(http.Hijacker)
+	n, ok2 := w.(http.CloseNotifier)
+	switch {
+	case ok1 && ok2:
+		return hijackCloseNotifier{cw, h, n}, cw
+	case ok1:
+		return hijackWriter{cw, h}, cw
+	case ok2:
+		return &closeNotifyWriter{cw, n}, cw
+	}
+	return cw, cw
+}
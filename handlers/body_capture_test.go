@@ -0,0 +1,164 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/graze/golang-service/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructuredBodyCapture(t *testing.T) {
+	echo := func(contentType string, status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.Header().Set("X-Response", "value")
+			w.WriteHeader(status)
+			w.Write(body)
+		})
+	}
+
+	cases := map[string]struct {
+		capture     *BodyCapture
+		contentType string
+		status      int
+		body        string
+		expected    map[string]interface{}
+		missing     []string
+	}{
+		"request and response": {
+			&BodyCapture{Request: true, Response: true}, "application/json", 200, `{"name":"bob"}`,
+			map[string]interface{}{"http.request.body": `{"name":"bob"}`, "http.response.body": `{"name":"bob"}`},
+			[]string{"http.request.truncated", "http.response.truncated", "http.request.headers"},
+		},
+		"only the request": {
+			&BodyCapture{Request: true}, "application/json", 200, `{}`,
+			map[string]interface{}{"http.request.body": `{}`},
+			[]string{"http.response.body"},
+		},
+		"truncated": {
+			&BodyCapture{Request: true, Response: true, MaxBytes: 4}, "text/plain; charset=utf-8", 200, "abcdefgh",
+			map[string]interface{}{
+				"http.request.body":       "abcd",
+				"http.request.truncated":  true,
+				"http.response.body":      "abcd",
+				"http.response.truncated": true,
+			},
+			nil,
+		},
+		"content type not captured": {
+			&BodyCapture{Request: true, Response: true}, "application/octet-stream", 200, "binary",
+			nil,
+			[]string{"http.request.body", "http.response.body"},
+		},
+		"response content type is detected": {
+			&BodyCapture{Response: true, ContentTypes: []string{"text/"}}, "", 200, "<html></html>",
+			map[string]interface{}{"http.response.body": "<html></html>"},
+			nil,
+		},
+		"status not captured": {
+			&BodyCapture{Request: true, Response: true, Headers: true, Statuses: []StatusRange{{Min: 400, Max: 599}}}, "application/json", 200, `{}`,
+			nil,
+			[]string{"http.request.body", "http.response.body", "http.request.headers", "http.response.headers"},
+		},
+		"status captured": {
+			&BodyCapture{Response: true, Statuses: []StatusRange{{Min: 400, Max: 499}, {Min: 500, Max: 599}}}, "application/json", 503, `{}`,
+			map[string]interface{}{"http.response.body": `{}`},
+			nil,
+		},
+		"json fields are redacted": {
+			&BodyCapture{Request: true}, "application/json", 200, `{"user":"bob","Password": "a \"b\"","nested":{"token":123}}`,
+			map[string]interface{}{"http.request.body": `{"user":"bob","Password": "[REDACTED]","nested":{"token":"[REDACTED]"}}`},
+			nil,
+		},
+		"truncated json is redacted": {
+			&BodyCapture{Request: true, MaxBytes: 20}, "application/json", 200, `{"password":"abcdefghijkl"}`,
+			map[string]interface{}{"http.request.body": `{"password":"[REDACTED]"`},
+			nil,
+		},
+		"form fields are redacted": {
+			&BodyCapture{Request: true, Redact: []string{"pin"}}, "application/x-www-form-urlencoded", 200, "user=bob&pin=1234&password=x",
+			map[string]interface{}{"http.request.body": "user=bob&pin=[REDACTED]&password=x"},
+			nil,
+		},
+		"headers with the default deny list": {
+			&BodyCapture{Headers: true}, "application/json", 200, `{}`,
+			map[string]interface{}{
+				"http.request.headers":  map[string]string{"Content-Type": "application/json", "X-Request": "value"},
+				"http.response.headers": map[string]string{"Content-Type": "application/json", "X-Response": "value"},
+			},
+			[]string{"http.request.body"},
+		},
+		"headers with an allow list": {
+			&BodyCapture{Headers: true, AllowedHeaders: []string{"x-request", "x-response", "authorization"}}, "application/json", 200, `{}`,
+			map[string]interface{}{
+				"http.request.headers":  map[string]string{"X-Request": "value"},
+				"http.response.headers": map[string]string{"X-Response": "value"},
+			},
+			nil,
+		},
+	}
+
+	for k, tc := range cases {
+		logger := log.New("", "", "")
+		hook := test.NewLocal(logger.Logger)
+
+		req, _ := http.NewRequest("POST", "http://example.com/items", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Request", "value")
+		rec := httptest.NewRecorder()
+
+		handler := StructuredLogHandlerWithOptions(logger, StructuredOptions{Bodies: tc.capture}, echo(tc.contentType, tc.status))
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.body, rec.Body.String(), "test: %s - the response is not changed", k)
+		entry := hook.LastEntry()
+		for field, value := range tc.expected {
+			assert.Equal(t, value, entry.Data[field], "test: %s - %s", k, field)
+		}
+		for _, field := range tc.missing {
+			assert.NotContains(t, entry.Data, field, "test: %s", k)
+		}
+	}
+}
+
+func TestStructuredBodyCaptureKeepsFlushAndStreaming(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	handler := StructuredLogHandlerWithOptions(logger, StructuredOptions{Bodies: &BodyCapture{Response: true}}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for _, chunk := range []string{"one\n", "two\n"} {
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "http://example.com/stream"))
+
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "one\ntwo\n", rec.Body.String())
+	assert.Equal(t, "one\ntwo\n", hook.LastEntry().Data["http.response.body"])
+	assert.Equal(t, 8, hook.LastEntry().Data["http.bytes"])
+	assert.Equal(t, 200, hook.LastEntry().Data["http.status"])
+}
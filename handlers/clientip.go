@@ -0,0 +1,185 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultTrustedProxies are the loopback and private networks, where load balancers and reverse proxies usually live
+var DefaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// DefaultClientIPResolver is used by GetUserIP, LoggingContextHandler, StructuredLogHandler and the healthd handlers
+//
+// It trusts the DefaultTrustedProxies, use SetTrustedProxies to change them
+var DefaultClientIPResolver, _ = NewClientIPResolver(DefaultTrustedProxies...)
+
+// DefaultClientIPHeader is the forwarding header used by a ClientIPResolver without a Header
+const DefaultClientIPHeader = "X-Forwarded-For"
+
+// ClientIPResolver finds the ip of the client making a request
+//
+// The forwarding header is only used if the request comes from a trusted proxy. The addresses in the header are
+// walked from right to left (nearest proxy first) and the first address that is not a trusted proxy is the client.
+// If an address is `unknown` or not valid the walk stops and the last trusted proxy is the client.
+type ClientIPResolver struct {
+	// TrustedProxies are the networks that the forwarding header is accepted from
+	TrustedProxies []*net.IPNet
+	// Header is the forwarding header set by the trusted proxies. Other forwarding headers are never used, as a client
+	// can send them through a proxy that does not replace them. Defaults to DefaultClientIPHeader
+	//
+	// `Forwarded` is parsed as RFC 7239, other headers as a comma separated list like `X-Forwarded-For`
+	Header string
+}
+
+// NewClientIPResolver creates a ClientIPResolver trusting the supplied networks, which can be CIDRs or single ips,
+// using the X-Forwarded-For header
+//
+// Usage:
+//  resolver, err := handlers.NewClientIPResolver("10.0.0.0/8", "172.31.5.4")
+//  ip, err := resolver.ClientIP(req)
+func NewClientIPResolver(trusted ...string) (*ClientIPResolver, error) {
+	networks, err := ParseNetworks(trusted...)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIPResolver{networks, DefaultClientIPHeader}, nil
+}
+
+// SetTrustedProxies changes the networks trusted by the DefaultClientIPResolver
+//
+// This should be called before handling any requests
+func SetTrustedProxies(trusted ...string) error {
+	networks, err := ParseNetworks(trusted...)
+	if err != nil {
+		return err
+	}
+	DefaultClientIPResolver.TrustedProxies = networks
+	return nil
+}
+
+// ParseNetworks parses a list of CIDRs (10.0.0.0/8) or single ips (10.0.0.1)
+func ParseNetworks(networks ...string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(networks))
+	for _, n := range networks {
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, fmt.Errorf("ParseNetworks: %q is not a valid IP or CIDR", n)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("ParseNetworks: %q is not a valid IP or CIDR", n)
+		}
+		parsed = append(parsed, network)
+	}
+	return parsed, nil
+}
+
+// ClientIP returns the ip of the client making req
+func (r *ClientIPResolver) ClientIP(req *http.Request) (net.IP, error) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("ClientIP: %q is not a valid IP:Port", req.RemoteAddr)
+	}
+	remote := net.ParseIP(host)
+	if remote == nil {
+		return nil, fmt.Errorf("ClientIP: %q is not a valid IP:port", req.RemoteAddr)
+	}
+	if !r.trusted(remote) {
+		return remote, nil
+	}
+
+	header := r.Header
+	if header == "" {
+		header = DefaultClientIPHeader
+	}
+	values := req.Header[http.CanonicalHeaderKey(header)]
+	var chain []string
+	if strings.EqualFold(header, "Forwarded") {
+		chain = parseForwarded(values)
+	} else {
+		for _, v := range values {
+			chain = append(chain, strings.Split(v, ",")...)
+		}
+	}
+
+	last := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseNode(chain[i])
+		if ip == nil {
+			// nothing to the left of an unknown node can be trusted
+			return last, nil
+		}
+		if i == 0 || !r.trusted(ip) {
+			return ip, nil
+		}
+		last = ip
+	}
+	return remote, nil
+}
+
+// trusted returns true if ip is within one of the TrustedProxies
+func (r *ClientIPResolver) trusted(ip net.IP) bool {
+	for _, network := range r.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseForwarded returns the `for` parameter of each element of RFC 7239 Forwarded headers
+//
+//  Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(values []string) (nodes []string) {
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(parts) == 2 && strings.EqualFold(parts[0], "for") {
+					node = strings.Trim(parts[1], `"`)
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return
+}
+
+// parseNode parses an ip with an optional port: `192.0.2.60`, `192.0.2.60:80`, `[2001:db8::17]:4711` or `2001:db8::17`
+//
+// It returns nil for `unknown` and obfuscated identifiers
+func parseNode(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
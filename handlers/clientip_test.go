@@ -0,0 +1,159 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver("10.0.0.0/8", "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		header   string
+		remote   string
+		headers  map[string][]string
+		expected net.IP
+	}{
+		"remote addr": {
+			"", "203.0.113.1:1234", nil, net.ParseIP("203.0.113.1"),
+		},
+		"untrusted remote ignores headers": {
+			"", "203.0.113.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			net.ParseIP("203.0.113.1"),
+		},
+		"trusted remote uses header": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			net.ParseIP("198.51.100.1"),
+		},
+		"right to left skipping trusted proxies": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1, 10.0.0.2"}},
+			net.ParseIP("198.51.100.1"),
+		},
+		"spoofed left entry is ignored": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"not an ip, 198.51.100.1"}},
+			net.ParseIP("198.51.100.1"),
+		},
+		"multiple headers": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1", "10.0.0.3"}},
+			net.ParseIP("198.51.100.1"),
+		},
+		"all trusted uses leftmost": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.5, 10.0.0.6"}},
+			net.ParseIP("10.0.0.5"),
+		},
+		"invalid nearest entry uses the remote addr": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1, nope"}},
+			net.ParseIP("10.0.0.1"),
+		},
+		"unknown entry uses the last trusted proxy": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1, unknown, 10.0.0.2"}},
+			net.ParseIP("10.0.0.2"),
+		},
+		"other forwarding headers are ignored": {
+			"", "10.0.0.5:1234",
+			map[string][]string{"Forwarded": {"for=198.51.100.77"}, "X-Real-Ip": {"198.51.100.78"}, "X-Forwarded-For": {"203.0.113.9"}},
+			net.ParseIP("203.0.113.9"),
+		},
+		"missing header": {
+			"", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=198.51.100.77"}},
+			net.ParseIP("10.0.0.1"),
+		},
+		"x-real-ip": {
+			"X-Real-Ip", "10.0.0.1:1234",
+			map[string][]string{"X-Real-Ip": {"198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}},
+			net.ParseIP("198.51.100.1"),
+		},
+		"forwarded": {
+			"Forwarded", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {`for=198.51.100.1;proto=https;by=10.0.0.1, For="10.0.0.7:8080"`}},
+			net.ParseIP("198.51.100.1"),
+		},
+		"forwarded ipv6": {
+			"Forwarded", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}},
+			net.ParseIP("2001:db8:cafe::17"),
+		},
+		"forwarded unknown": {
+			"Forwarded", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=unknown"}},
+			net.ParseIP("10.0.0.1"),
+		},
+		"trusted single ipv6": {
+			"", "[2001:db8::1]:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			net.ParseIP("198.51.100.1"),
+		},
+	}
+
+	for k, tc := range cases {
+		resolver.Header = tc.header
+		req := newRequest("GET", "http://example.com")
+		req.RemoteAddr = tc.remote
+		for h, values := range tc.headers {
+			for _, v := range values {
+				req.Header.Add(h, v)
+			}
+		}
+		ip, err := resolver.ClientIP(req)
+		assert.NoError(t, err, "test: %s", k)
+		assert.Equal(t, tc.expected, ip, "test: %s", k)
+	}
+
+	req := newRequest("GET", "http://example.com")
+	_, err = resolver.ClientIP(req)
+	assert.Error(t, err, "invalid remote addr")
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8", "192.168.0.1", "::1")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "192.168.0.1/32", networks[1].String())
+	assert.Equal(t, "::1/128", networks[2].String())
+
+	_, err = ParseNetworks("nope")
+	assert.Error(t, err)
+	_, err = ParseNetworks("10.0.0.0/99")
+	assert.Error(t, err)
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	defer SetTrustedProxies(DefaultTrustedProxies...)
+
+	req := newRequest("GET", "http://example.com")
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1")
+
+	ip, _ := GetUserIP(req)
+	assert.Equal(t, net.ParseIP("198.51.100.1"), ip)
+
+	assert.NoError(t, SetTrustedProxies("172.16.0.0/12"))
+	ip, _ = GetUserIP(req)
+	assert.Equal(t, net.ParseIP("10.0.0.1"), ip)
+
+	assert.Error(t, SetTrustedProxies("nope"))
+}
@@ -30,8 +30,12 @@ func (h logContextHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if userIP, err := getUserIP(req); err == nil {
 		ip = userIP.String()
 	}
+	transaction := GetRequestID(req)
+	if transaction == "" {
+		transaction = uuid.NewV4().String()
+	}
 	ctx := h.logger.Ctx(req.Context()).With(log.KV{
-		"transaction":     uuid.NewV4().String(),
+		"transaction":     transaction,
 		"http.method":     req.Method,
 		"http.protocol":   req.Proto,
 		"http.uri":        parseURI(req, url),
@@ -55,7 +59,7 @@ func (h logContextHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 //	http.user		- 192.168.0.1 - ip address of the user
 //	http.ref		- http://google.com - referrer
 //	http.user-agent - The user agent of the user
-//  transaction     - unique uuid4 for this request
+//  transaction     - the request id from RequestIDHandler or a unique uuid4 for this request
 func LoggingContextHandler(logger log.FieldLogger, h http.Handler) http.Handler {
 	return logContextHandler{logger.With(log.KV{}), h}
 }
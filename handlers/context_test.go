@@ -26,6 +26,7 @@ func TestContextUpdatesTheRequestContext(t *testing.T) {
 
 	userRequest := newRequest("GET", "http://example.com")
 	userRequest.Header.Add("X-Forwarded-For", "192.168.100.5")
+	userRequest.RemoteAddr = "10.0.0.1:1234"
 
 	userAgentRequest := newRequest("GET", "http://example.com")
 	userAgentRequest.Header.Add("User-Agent", "some user agent")
@@ -24,9 +24,45 @@ Usage:
     loggedRouter := handlers.AllHandlers(r)
     http.ListenAndServe(":1123", loggedRouter)
 
+The handlers applied by AllHandlers can be turned on or off using environment variables
+
+Environment Variables:
+    HANDLERS_REQUEST_ID: Add a request id to each request (default: true)
+    HANDLERS_TRACE: Continue or start a W3C trace for each request (default: true)
+    HANDLERS_CONTEXT: Add the logging context to each request (default: true)
+    HANDLERS_STRUCTURED: Write a structured log entry for each request (default: true)
+    HANDLERS_STATSD: Send request metrics to statsd (default: true when STATSD_HOST or DD_AGENT_HOST is set)
+    HANDLERS_HEALTHD: Write healthd logs (default: false)
+    HANDLERS_HEALTHD_DIR: The directory to write healthd logs to (default: /var/log/nginx/healthd/)
+
+Or configured in code using AllHandlersWith
+    loggedRouter := handlers.AllHandlersWith(handlers.AllConf{Context: true, Structured: true}, r)
+
+The statsd and structured log handlers are configured with the StatsdOptions and StructuredOptions fields
+    loggedRouter := handlers.AllHandlersWith(handlers.AllConf{
+        Structured:        true,
+        StructuredOptions: &handlers.StructuredOptions{Exclude: []string{"/health"}},
+    }, r)
+
 They can also be manually chained together
     loggedRouter := handlers.StatsdHandler(handlers.HealthdHandler(r))
 
+Request ID
+
+Give each request an id, using a valid inbound X-Request-Id header or generating one. The id is echoed in the
+X-Request-Id response header and is the transaction of the logging context
+
+    loggedRouter := handlers.RequestIDHandler(handlers.LoggingContextHandler(log.With(log.KV{}), r))
+    id := handlers.GetRequestID(req)
+
+Trace Context
+
+Continue a W3C trace (traceparent and tracestate headers) with a new span, or start a new trace. The trace and span
+ids are added to the logging context and can be passed on to other services
+
+    loggedRouter := handlers.TraceHandler(handlers.LoggingContextHandler(log.With(log.KV{}), r))
+    handlers.InjectTrace(req.Context(), outgoingRequest)
+
 Logging Context
 
 This creates a logging context to be passed into the handling function with information about the request
@@ -37,7 +73,7 @@ Usage:
         log.Ctx(r.Context()).Info("log a message with the context")
         w.Write([]byte("This is a catch-all route"))
     })
-    loggedRouter := handlers.LogContextHandler(r)
+    loggedRouter := handlers.LoggingContextHandler(log.With(log.KV{}), r)
     http.ListenAndServe(":1123", loggedRouter)
 
 Healthd
@@ -53,6 +89,13 @@ Usage:
     loggedRouter := handlers.HealthdHandler(r)
     http.ListenAndServe(":1123", loggedRouter)
 
+A HealthdWriter writes to a new file each hour and can compress and remove old files
+
+    writer := handlers.NewHealthdWriter("/var/log/nginx/healthd/")
+    writer.Compress = true
+    writer.MaxFiles = 24
+    loggedRouter := handlers.HealthdIoHandler(writer, r)
+
 Statsd
 
 Log request duration to a statsd host
@@ -62,6 +105,10 @@ Environment Variables:
     STATSD_PORT: The port of the statsd server
     STATSD_NAMESPACE: The namespace to prefix to every metric name
     STATSD_TAGS: A comma separared list of tags to apply to every metric reported
+    STATSD_BUFFER: The number of metrics to buffer before sending them (default: 0)
+    STATSD_DISABLED: Send no metrics (default: false)
+    DD_AGENT_HOST, DD_DOGSTATSD_PORT: Used if STATSD_HOST or STATSD_PORT are not set
+    DD_ENV, DD_SERVICE, DD_VERSION: Added as env, service and version tags
 
 Example:
     STATSD_HOST: localhost
@@ -77,6 +124,33 @@ Usage:
     loggedRouter := handlers.StatsdHandler(r)
     http.ListenAndServe(":1123", loggedRouter)
 
+Normalise the endpoint tag to stop ids in paths creating a new series for each request. Numeric and UUID segments
+become {id}, a route template can be set with SetRoute, and paths not in the allow-list become other
+
+    paths := handlers.NewPathNormaliser("/", "/users/{id}")
+    loggedRouter := handlers.StatsdIoHandlerWithPaths(c, paths, r)
+
+The metric names, extra tags, sample rate, a response size histogram and a statusClass tag can be set with
+StatsdOptions. Handlers further down the chain can add tags with AddStatsdTags
+
+    loggedRouter := handlers.StatsdIoHandlerWithOptions(c, handlers.StatsdOptions{
+        CountMetric: "http.count",
+        SizeMetric:  "http.response_size",
+        StatusClass: true,
+        Tags:        []string{"service:api"},
+    }, r)
+
+Prometheus
+
+Record request counts, durations, response sizes and in flight requests labelled by method, route and status, and
+expose them in the Prometheus text format
+
+Usage:
+    metrics := handlers.NewPrometheusMetrics("http")
+    http.Handle("/metrics", metrics.MetricsHandler())
+    http.Handle("/", handlers.PrometheusHandler(metrics, r))
+    http.ListenAndServe(":1123", nil)
+
 Structured
 
 Log requests using a structured format for handling with json/logfmt
@@ -93,5 +167,47 @@ Usage:
 
 Default Output:
     time="2016-10-28T10:51:32Z" level=info msg="GET / HTTP/1.1" dur=0.003200881 http.bytes=80 http.host="localhost:1123" http.method=GET http.path="/" http.protocol="HTTP/1.1" http.ref= http.status=200 http.uri="/" http.user= module=request.handler tag="request_handled" ts="2016-10-28T10:51:31.542424381Z"
+
+The level can be chosen by status, paths excluded and successful requests sampled, while slow requests are always
+logged
+
+    loggedRouter := handlers.StructuredLogHandlerWithOptions(logger, handlers.StructuredOptions{
+        Levels:            handlers.DefaultStatusLevels,
+        Exclude:           []string{"/health"},
+        SuccessSampleRate: 0.1,
+        SlowThreshold:     time.Second,
+    }, r)
+
+Request and response bodies and headers can be logged up to a limit for selected content types and statuses, with
+sensitive headers and fields removed
+
+    loggedRouter := handlers.StructuredLogHandlerWithOptions(logger, handlers.StructuredOptions{
+        Bodies: &handlers.BodyCapture{Request: true, Response: true, Statuses: []handlers.StatusRange{{Min: 400, Max: 599}}},
+    }, r)
+
+Access Log
+
+Write an access log in the Apache Common or Combined Log Format, or using nginx log_format style variables
+
+    loggedRouter := handlers.CombinedLogHandler(os.Stdout, r)
+
+    format, err := handlers.NewAccessLogFormat(`$remote_addr "$request" $status $body_bytes_sent $request_time`)
+    loggedRouter := handlers.AccessLogHandler(os.Stdout, format, r)
+
+Outbound Requests
+
+Log and time requests to other services, passing on the request id and trace of the request context
+
+    client := &http.Client{Transport: handlers.NewTransport(nil, log.With(log.KV{}), statsdClient)}
+    resp, err := client.Do(out.WithContext(r.Context()))
+
+Client IP
+
+The ip of the client (http.user) is found by the DefaultClientIPResolver. The X-Forwarded-For header is only used from
+trusted proxies, which default to the loopback and private networks. Other forwarding headers are ignored unless set as
+the Header of the resolver.
+
+    handlers.SetTrustedProxies("10.0.0.0/8", "172.31.5.4")
+    handlers.DefaultClientIPResolver.Header = "Forwarded"
 */
 package handlers
@@ -16,8 +16,15 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/graze/golang-service/log"
+	"github.com/graze/golang-service/rotate"
 )
 
 type healthdHandler struct {
@@ -41,9 +48,15 @@ func (h healthdHandler) writeLog(w LoggingResponseWriter, req *http.Request, url
 // status and size are used to provide response HTTP status and size
 //
 // The format of the file is:
-// <unix_timestamp.ms>"<path>"<status>"<request_time>"<upstream_time>"<X-Forwarded-For header>
+// <unix_timestamp.ms>"<path>"<status>"<request_time>"<upstream_time>"<client ip>
+//
+// The client ip is found using the DefaultClientIPResolver
 func writeHealthdLog(w io.Writer, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
 	uri := parseURI(req, url)
+	ip := ""
+	if userIP, err := getUserIP(req); err == nil {
+		ip = userIP.String()
+	}
 	msDur := float64(dur.Nanoseconds()) / (float64(time.Second) / float64(time.Nanosecond))
 	str := fmt.Sprintf(`%.3f%s%d"%.3f"%.3f"%s`+"\n",
 		float64(ts.UnixNano())/(float64(time.Second)/float64(time.Nanosecond)),
@@ -51,7 +64,7 @@ func writeHealthdLog(w io.Writer, req *http.Request, url url.URL, ts time.Time,
 		status,
 		msDur,
 		msDur,
-		req.Header.Get("X-Forwarded-For"))
+		ip)
 	io.WriteString(w, str)
 }
 
@@ -72,27 +85,172 @@ func HealthdIoHandler(out io.Writer, h http.Handler) http.Handler {
 	return healthdHandler{out, h}
 }
 
-type healthdFileHandler struct {
-	path      string
-	base      http.Handler
-	handler   http.Handler
-	timestamp string
+// DefaultHealthdDir is the directory AWS Elastic Beanstalk reads healthd logs from
+const DefaultHealthdDir = "/var/log/nginx/healthd/"
+
+// healthdPrefix is the name of each healthd log file before the hour
+const healthdPrefix = "application.log."
+
+// HealthdWriter is an io.WriteCloser that writes to a new file in Dir each hour, named
+// application.log.<year>-<month>-<day>-<hour> as expected by healthd
+//
+// It is safe for concurrent use. Each file is kept open until the hour changes, when the next file is opened before
+// the previous one is closed. Errors opening files are logged rather than returned from the handler.
+type HealthdWriter struct {
+	// Dir is the directory the log files are written to
+	Dir string
+	// Compress gzips each file after it is rotated
+	Compress bool
+	// MaxFiles is the number of rotated files to keep, 0 keeps every file
+	MaxFiles int
+	// Logger reports errors opening, compressing and removing files. Defaults to the global logger
+	Logger log.FieldLogger
+
+	mu     sync.Mutex
+	file   *os.File
+	hour   string
+	failed string
+	now    func() time.Time
+	wg     sync.WaitGroup
+}
+
+// Write writes p to the file for the current hour, opening it if required
+func (w *HealthdWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hour := w.clock().UTC().Format("2006-01-02-15")
+	if w.file == nil || w.hour != hour {
+		if err := w.rotate(hour); err != nil {
+			return 0, err
+		}
+	}
+	return w.file.Write(p)
+}
+
+// Close closes the current file and waits for any rotated files to be compressed
+func (w *HealthdWriter) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file, w.hour = nil, ""
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	return err
+}
+
+// rotate opens the file for hour and closes the previous file. The previous file is kept if the new one can not be
+// opened
+func (w *HealthdWriter) rotate(hour string) error {
+	if err := os.MkdirAll(w.Dir, 0755); err != nil {
+		return w.openFailed(hour, err)
+	}
+	file, err := os.OpenFile(filepath.Join(w.Dir, healthdPrefix+hour), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return w.openFailed(hour, err)
+	}
+
+	previous := w.file
+	w.file, w.hour, w.failed = file, hour, ""
+	if previous == nil {
+		return nil
+	}
+
+	if err := previous.Close(); err != nil {
+		w.logger().Err(err).Warnf("failed to close healthd log file: %s", previous.Name())
+	}
+	w.wg.Add(1)
+	go func(name string) {
+		defer w.wg.Done()
+		if w.Compress {
+			if err := rotate.CompressFile(name); err != nil {
+				w.logger().Err(err).Warnf("failed to compress healthd log file: %s", name)
+			}
+		}
+		w.prune()
+	}(previous.Name())
+	return nil
+}
+
+// openFailed logs the first failure to open a file for each hour and returns err
+func (w *HealthdWriter) openFailed(hour string, err error) error {
+	if w.failed != hour {
+		w.failed = hour
+		w.logger().Err(err).Errorf("failed to open healthd log file in: %s", w.Dir)
+	}
+	return err
 }
 
-// ServerHTTP for the healthdFileHandler automatically rotates the log files based on the hour
-func (h healthdFileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	now := time.Now().UTC().Format("2006-01-02-15")
-	if h.timestamp != now || h.base == nil {
-		h.timestamp = now
-		file := h.path + "application.log." + now
-		logFile, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-		if err != nil {
-			panic(err)
+// prune removes the oldest rotated files so that at most MaxFiles are kept
+func (w *HealthdWriter) prune() {
+	if w.MaxFiles <= 0 {
+		return
+	}
+	w.mu.Lock()
+	current := ""
+	if w.file != nil {
+		current = filepath.Base(w.file.Name())
+	}
+	w.mu.Unlock()
+
+	names, err := filepath.Glob(filepath.Join(w.Dir, healthdPrefix+"*"))
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, name := range names {
+		if base := filepath.Base(name); base != current && !strings.HasSuffix(base, ".tmp") {
+			rotated = append(rotated, name)
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > w.MaxFiles {
+		if err := os.Remove(rotated[0]); err != nil && !os.IsNotExist(err) {
+			w.logger().Err(err).Warnf("failed to remove healthd log file: %s", rotated[0])
 		}
-		defer logFile.Close()
-		h.base = HealthdIoHandler(logFile, h.handler)
+		rotated = rotated[1:]
+	}
+}
+
+// clock returns the current time
+func (w *HealthdWriter) clock() time.Time {
+	if w.now != nil {
+		return w.now()
 	}
-	h.base.ServeHTTP(w, req)
+	return time.Now()
+}
+
+// logger returns the Logger or a default logger
+func (w *HealthdWriter) logger() log.FieldLogger {
+	if w.Logger != nil {
+		return w.Logger
+	}
+	return log.With(log.KV{"module": "healthd"})
+}
+
+// NewHealthdWriter creates a HealthdWriter writing hourly files to dir
+func NewHealthdWriter(dir string) *HealthdWriter {
+	return &HealthdWriter{Dir: dir}
+}
+
+// HealthdDirHandler return a http.Handler that wraps h and logs requests in nginx Healthd format to hourly files in
+// dir named application.log.<year>-<month>-<day>-<hour>
+//
+// To compress or remove old files use HealthdIoHandler with a HealthdWriter. To write healthd logs to a single file
+// rotated by size use HealthdIoHandler with a rotate.File
+//
+// Usage:
+//  loggedRouter := handlers.HealthdDirHandler("/var/log/healthd/", r)
+//
+//  writer := handlers.NewHealthdWriter("/var/log/healthd/")
+//  writer.Compress = true
+//  writer.MaxFiles = 24
+//  loggedRouter := handlers.HealthdIoHandler(writer, r)
+func HealthdDirHandler(dir string, h http.Handler) http.Handler {
+	return HealthdIoHandler(NewHealthdWriter(dir), h)
 }
 
 // HealthdHandler return a http.Handler that wraps h and logs request to out in
@@ -110,11 +268,5 @@ func (h healthdFileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 //  http.ListenAndServe(":1123", loggedRouter)
 //
 func HealthdHandler(h http.Handler) http.Handler {
-	path := "/var/log/nginx/healthd/"
-	err := os.MkdirAll(path, 0666)
-	if err != nil {
-		panic(err)
-	}
-
-	return healthdFileHandler{path, nil, h, ""}
+	return HealthdDirHandler(DefaultHealthdDir, h)
 }
@@ -12,13 +12,18 @@ package handlers
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/graze/golang-service/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,6 +92,7 @@ func TestHealthdLogging(t *testing.T) {
 
 	headerRequest := newRequest("GET", "http://example.com")
 	headerRequest.Header.Add("X-Forwarded-For", "192.168.100.5")
+	headerRequest.RemoteAddr = "10.0.0.1:1234"
 
 	cases := map[string]struct {
 		ts       time.Time
@@ -116,3 +122,111 @@ func TestHealthdLogging(t *testing.T) {
 		assert.Equal(t, tc.expected+"\n", log, "test: %s", k)
 	}
 }
+
+// healthdClock returns a function returning the time pointed to by now
+func healthdClock(now *time.Time) func() time.Time {
+	return func() time.Time {
+		return *now
+	}
+}
+
+func TestHealthdWriterRotatesHourly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "healthd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2016, 10, 28, 10, 59, 0, 0, time.UTC)
+	writer := NewHealthdWriter(dir)
+	writer.now = healthdClock(&now)
+
+	writer.Write([]byte("one\n"))
+	writer.Write([]byte("two\n"))
+	now = now.Add(time.Minute)
+	writer.Write([]byte("three\n"))
+	assert.NoError(t, writer.Close())
+
+	cases := map[string]struct {
+		file     string
+		expected string
+	}{
+		"first hour":  {"application.log.2016-10-28-10", "one\ntwo\n"},
+		"second hour": {"application.log.2016-10-28-11", "three\n"},
+	}
+
+	for k, tc := range cases {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, tc.file))
+		assert.NoError(t, err, "test: %s", k)
+		assert.Equal(t, tc.expected, string(contents), "test: %s", k)
+	}
+}
+
+func TestHealthdWriterCompressesAndPrunes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "healthd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2016, 10, 28, 10, 0, 0, 0, time.UTC)
+	writer := NewHealthdWriter(dir)
+	writer.Compress = true
+	writer.MaxFiles = 2
+	writer.now = healthdClock(&now)
+
+	for i := 0; i < 4; i++ {
+		writer.Write([]byte("line\n"))
+		writer.wg.Wait()
+		now = now.Add(time.Hour)
+	}
+	assert.NoError(t, writer.Close())
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for i := range names {
+		names[i] = filepath.Base(names[i])
+	}
+	assert.Equal(t, []string{
+		"application.log.2016-10-28-11.gz",
+		"application.log.2016-10-28-12.gz",
+		"application.log.2016-10-28-13",
+	}, names)
+
+	file, err := os.Open(filepath.Join(dir, "application.log.2016-10-28-12.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, "line\n", string(contents))
+}
+
+func TestHealthdWriterLogsOpenErrors(t *testing.T) {
+	file, err := ioutil.TempFile("", "healthd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+	writer := NewHealthdWriter(filepath.Join(file.Name(), "not-a-dir"))
+	writer.Logger = logger
+
+	handler := HealthdIoHandler(writer, okHandler)
+	rec := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		handler.ServeHTTP(rec, newRequest("GET", "http://example.com/"))
+		handler.ServeHTTP(rec, newRequest("GET", "http://example.com/"))
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Len(t, hook.Entries, 1, "only the first failure each hour is logged")
+	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+	assert.Error(t, hook.LastEntry().Data[logrus.ErrorKey].(error))
+}
@@ -0,0 +1,187 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PathNormaliser turns the path of a request into an endpoint with a limited number of values, so that metrics tagged
+// with the endpoint do not create a new series for every id in a path
+//
+// The endpoint is found by:
+//  1. the route template of the request from Route, or set by SetRoute (e.g. /users/{id})
+//  2. otherwise the request path, with numeric and UUID segments replaced by Placeholder if CollapseIDs is set
+//  3. if Allowed is not empty, any endpoint not in Allowed is replaced by Other
+type PathNormaliser struct {
+	// Route returns the route template of a request, or an empty string if it is not known
+	Route func(req *http.Request) string
+	// CollapseIDs replaces numeric and UUID path segments with Placeholder
+	CollapseIDs bool
+	// Placeholder replaces collapsed segments. Defaults to {id}
+	Placeholder string
+	// Allowed is the list of endpoints that are reported. An empty list allows every endpoint
+	Allowed []string
+	// Other replaces endpoints that are not Allowed. Defaults to other
+	Other string
+}
+
+// Normalise returns the endpoint of req
+func (n *PathNormaliser) Normalise(req *http.Request) string {
+	return n.normalise(req, *req.URL)
+}
+
+// normalise returns the endpoint of req using url as the original request url
+func (n *PathNormaliser) normalise(req *http.Request, url url.URL) string {
+	if n == nil {
+		return uriPath(req, url)
+	}
+
+	endpoint := ""
+	if n.Route != nil {
+		endpoint = n.Route(req)
+	}
+	if endpoint == "" {
+		endpoint = GetRoute(req)
+	}
+	if endpoint == "" {
+		endpoint = uriPath(req, url)
+		if n.CollapseIDs {
+			endpoint = n.collapse(endpoint)
+		}
+	}
+
+	if len(n.Allowed) > 0 && !n.allowed(endpoint) {
+		if n.Other == "" {
+			return "other"
+		}
+		return n.Other
+	}
+	return endpoint
+}
+
+// collapse replaces the numeric and UUID segments of path with the placeholder
+func (n *PathNormaliser) collapse(path string) string {
+	placeholder := n.Placeholder
+	if placeholder == "" {
+		placeholder = "{id}"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isNumeric(segment) || isUUID(segment) {
+			segments[i] = placeholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// allowed returns true if endpoint is in the Allowed list
+func (n *PathNormaliser) allowed(endpoint string) bool {
+	for _, allowed := range n.Allowed {
+		if endpoint == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumeric returns true if s is not empty and only contains digits
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID returns true if s is a hyphenated UUID in either case
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NewPathNormaliser creates a PathNormaliser that collapses numeric and UUID segments and only allows the endpoints
+// in allowed, if any are given
+//
+// Usage:
+//  paths := handlers.NewPathNormaliser("/", "/users", "/users/{id}")
+//  paths.Normalise(req) // /users/123 -> /users/{id}, /admin -> other
+func NewPathNormaliser(allowed ...string) *PathNormaliser {
+	return &PathNormaliser{CollapseIDs: true, Allowed: allowed}
+}
+
+// requestHolder is stored in the request context by handlers that report on a request so that handlers further down
+// the chain can add the matched route and extra tags
+type requestHolder struct {
+	route string
+	tags  []string
+}
+
+// withRequestHolder returns req with a requestHolder in its context, if it does not already have one
+func withRequestHolder(req *http.Request) *http.Request {
+	if _, ok := req.Context().Value(holderKey).(*requestHolder); ok {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), holderKey, &requestHolder{}))
+}
+
+// getRequestHolder returns the requestHolder of req, or nil
+func getRequestHolder(req *http.Request) *requestHolder {
+	holder, _ := req.Context().Value(holderKey).(*requestHolder)
+	return holder
+}
+
+// SetRoute records the route template that matched req, for use as the endpoint by the statsd, structured log and
+// prometheus handlers. It does nothing if req is not handled by one of them
+//
+// Usage:
+//  r.Use(func(next http.Handler) http.Handler {
+//      return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//          if tpl, err := mux.CurrentRoute(r).GetPathTemplate(); err == nil {
+//              handlers.SetRoute(r, tpl)
+//          }
+//          next.ServeHTTP(w, r)
+//      })
+//  })
+func SetRoute(req *http.Request, route string) {
+	if holder := getRequestHolder(req); holder != nil {
+		holder.route = route
+	}
+}
+
+// GetRoute returns the route template recorded by SetRoute, or an empty string
+func GetRoute(req *http.Request) string {
+	if holder := getRequestHolder(req); holder != nil {
+		return holder.route
+	}
+	return ""
+}
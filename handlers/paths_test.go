@@ -0,0 +1,99 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/graze/golang-service/log"
+	"github.com/graze/golang-service/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathNormaliser(t *testing.T) {
+	cases := map[string]struct {
+		paths    *PathNormaliser
+		url      string
+		expected string
+	}{
+		"nil uses the path":           {nil, "http://example.com/users/123?a=b", "/users/123"},
+		"numeric segment":             {NewPathNormaliser(), "http://example.com/users/123/orders/45", "/users/{id}/orders/{id}"},
+		"uuid segment":                {NewPathNormaliser(), "http://example.com/users/1B4E28BA-2FA1-11D2-883F-0016D3CCA427", "/users/{id}"},
+		"not an id":                   {NewPathNormaliser(), "http://example.com/users/12a/v2", "/users/12a/v2"},
+		"root":                        {NewPathNormaliser(), "http://example.com/", "/"},
+		"no collapsing":               {&PathNormaliser{}, "http://example.com/users/123", "/users/123"},
+		"custom placeholder":          {&PathNormaliser{CollapseIDs: true, Placeholder: ":id"}, "http://example.com/users/123", "/users/:id"},
+		"allowed":                     {NewPathNormaliser("/users/{id}"), "http://example.com/users/123", "/users/{id}"},
+		"not allowed":                 {NewPathNormaliser("/users/{id}"), "http://example.com/admin", "other"},
+		"custom other":                {&PathNormaliser{Allowed: []string{"/"}, Other: "unknown"}, "http://example.com/admin", "unknown"},
+		"route takes precedence":      {&PathNormaliser{CollapseIDs: true, Route: func(*http.Request) string { return "/users/:user" }}, "http://example.com/users/123", "/users/:user"},
+		"empty route uses the path":   {&PathNormaliser{CollapseIDs: true, Route: func(*http.Request) string { return "" }}, "http://example.com/users/123", "/users/{id}"},
+		"route checked against allow": {&PathNormaliser{Allowed: []string{"/"}, Route: func(*http.Request) string { return "/users/:user" }}, "http://example.com/users/123", "other"},
+	}
+
+	for k, tc := range cases {
+		assert.Equal(t, tc.expected, tc.paths.Normalise(newRequest("GET", tc.url)), "test: %s", k)
+	}
+}
+
+func TestSetRoute(t *testing.T) {
+	req := newRequest("GET", "http://example.com/users/123")
+	SetRoute(req, "/ignored")
+	assert.Equal(t, "", GetRoute(req), "no holder in the context")
+
+	req = withRequestHolder(req)
+	assert.Equal(t, req, withRequestHolder(req), "an existing holder is reused")
+	SetRoute(req, "/users/{user}")
+	assert.Equal(t, "/users/{user}", GetRoute(req))
+	assert.Equal(t, "/users/{user}", NewPathNormaliser().Normalise(req))
+}
+
+func TestStatsdIoHandlerWithPaths(t *testing.T) {
+	cases := map[string]struct {
+		handler  http.Handler
+		url      string
+		expected string
+	}{
+		"collapsed": {okHandler, "http://example.com/users/123", "endpoint:/users/{id}"},
+		"other":     {okHandler, "http://example.com/admin/123", "endpoint:other"},
+		"route set by the handler": {http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetRoute(r, "/admin/{page}")
+		}), "http://example.com/admin/settings", "endpoint:/admin/{page}"},
+	}
+
+	paths := NewPathNormaliser("/users/{id}", "/admin/{page}")
+	for k, tc := range cases {
+		recorder := metrics.NewRecorder()
+		StatsdIoHandlerWithPaths(recorder, paths, tc.handler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", tc.url))
+
+		counts := recorder.Find("request.count")
+		if assert.Len(t, counts, 1, "test: %s", k) {
+			assert.Contains(t, counts[0].Tags, tc.expected, "test: %s", k)
+		}
+	}
+}
+
+func TestStructuredLogHandlerWithPaths(t *testing.T) {
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	StructuredLogHandlerWithPaths(logger, NewPathNormaliser(), okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/users/123"))
+	entry := hook.LastEntry()
+	assert.Equal(t, "/users/{id}", entry.Data["http.endpoint"])
+	assert.Equal(t, "/users/123", entry.Data["http.path"])
+
+	StructuredLogHandler(logger, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/users/123"))
+	_, ok := hook.LastEntry().Data["http.endpoint"]
+	assert.False(t, ok, "no endpoint without a normaliser")
+}
@@ -0,0 +1,341 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultDurationBuckets are the upper bounds in seconds of the request duration histogram
+	DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the upper bounds in bytes of the response size histogram
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// DefaultMaxRoutes is the number of distinct paths labelled by a PrometheusMetrics without a Route or MaxRoutes
+const DefaultMaxRoutes = 500
+
+// PrometheusMetrics records request metrics and exposes them in the Prometheus text format
+//
+// The following metrics are recorded, prefixed with the Namespace:
+//  <namespace>_requests_total              - counter of requests by method, route and status
+//  <namespace>_request_duration_seconds    - histogram of request durations by method, route and status
+//  <namespace>_response_size_bytes         - histogram of response sizes by method, route and status
+//  <namespace>_requests_in_flight          - gauge of requests being handled by method and route
+type PrometheusMetrics struct {
+	// Namespace prefixes each metric name
+	Namespace string
+	// DurationBuckets are the upper bounds of the duration histogram buckets in seconds
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds of the response size histogram buckets in bytes
+	SizeBuckets []float64
+	// Route returns the route label of a request. Defaults to the route set by SetRoute, otherwise the path of the
+	// request with numeric and UUID segments replaced by {id} (see NewPathNormaliser)
+	Route func(req *http.Request) string
+	// MaxRoutes is the number of distinct paths used as the route label when Route is not set. Requests for any
+	// other path are labelled `other`, so requests for random paths can not create an unbounded number of series.
+	// Defaults to DefaultMaxRoutes
+	MaxRoutes int
+
+	// mu guards the series, which are created by the first request
+	mu        sync.Mutex
+	requests  map[promLabels]float64
+	durations map[promLabels]*histogram
+	sizes     map[promLabels]*histogram
+	inFlight  map[promLabels]float64
+	paths     map[string]bool
+}
+
+// promLabels are the labels of a single series
+type promLabels struct {
+	method, route, status string
+}
+
+// histogram is a cumulative histogram of observations
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// newHistogram creates a histogram with a sorted copy of buckets without duplicates, so changes to the buckets do not
+// affect existing series
+func newHistogram(buckets []float64) *histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	unique := sorted[:0]
+	for i, upper := range sorted {
+		if i == 0 || upper != sorted[i-1] {
+			unique = append(unique, upper)
+		}
+	}
+	return &histogram{
+		buckets: unique,
+		counts:  make([]uint64, len(unique)),
+	}
+}
+
+// observe adds v to the histogram
+func (h *histogram) observe(v float64) {
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type prometheusHandler struct {
+	metrics *PrometheusMetrics
+	handler http.Handler
+}
+
+// ServeHTTP records the request in the metrics
+func (h prometheusHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req = withRequestHolder(req)
+	labels := promLabels{req.Method, h.metrics.route(req), ""}
+	h.metrics.addInFlight(labels, 1)
+	defer h.metrics.addInFlight(labels, -1)
+
+	LogServeHTTP(w, req, h.handler, h.writeLog)
+}
+
+// writeLog records the status, duration and size of a request
+func (h prometheusHandler) writeLog(w LoggingResponseWriter, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
+	h.metrics.observe(promLabels{req.Method, h.metrics.route(req), strconv.Itoa(status)}, dur, size)
+}
+
+// route returns the route label for req
+func (p *PrometheusMetrics) route(req *http.Request) string {
+	if p.Route != nil {
+		return p.Route(req)
+	}
+	if route := GetRoute(req); route != "" {
+		return route
+	}
+
+	path := defaultRoutes.Normalise(req)
+	max := p.MaxRoutes
+	if max <= 0 {
+		max = DefaultMaxRoutes
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paths == nil {
+		p.paths = make(map[string]bool)
+	}
+	if !p.paths[path] {
+		if len(p.paths) >= max {
+			return "other"
+		}
+		p.paths[path] = true
+	}
+	return path
+}
+
+// defaultRoutes is the route label of a PrometheusMetrics without a Route
+var defaultRoutes = NewPathNormaliser()
+
+// init creates the series of a PrometheusMetrics that was not created with NewPrometheusMetrics, p.mu must be held
+func (p *PrometheusMetrics) init() {
+	if p.requests == nil {
+		p.requests = make(map[promLabels]float64)
+		p.durations = make(map[promLabels]*histogram)
+		p.sizes = make(map[promLabels]*histogram)
+		p.inFlight = make(map[promLabels]float64)
+	}
+}
+
+// addInFlight changes the number of requests being handled
+func (p *PrometheusMetrics) addInFlight(labels promLabels, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	p.inFlight[labels] += delta
+}
+
+// observe records a completed request
+func (p *PrometheusMetrics) observe(labels promLabels, dur time.Duration, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	p.requests[labels]++
+	if _, ok := p.durations[labels]; !ok {
+		p.durations[labels] = newHistogram(p.DurationBuckets)
+		p.sizes[labels] = newHistogram(p.SizeBuckets)
+	}
+	p.durations[labels].observe(dur.Seconds())
+	p.sizes[labels].observe(float64(size))
+}
+
+// MetricsHandler returns a http.Handler that writes the metrics in the Prometheus text exposition format
+//
+// Usage:
+//  metrics := handlers.NewPrometheusMetrics("http")
+//  http.Handle("/metrics", metrics.MetricsHandler())
+//  http.Handle("/", handlers.PrometheusHandler(metrics, r))
+func (p *PrometheusMetrics) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(p.Expose())
+	})
+}
+
+// Expose returns the metrics in the Prometheus text exposition format
+func (p *PrometheusMetrics) Expose() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	name := p.name("requests_total")
+	writeHeader(buf, name, "counter", "Total number of HTTP requests handled")
+	for _, l := range sortedLabels(p.requests) {
+		fmt.Fprintf(buf, "%s%s %s\n", name, l.format(true, ""), formatFloat(p.requests[l]))
+	}
+
+	writeHistograms(buf, p.name("request_duration_seconds"), "Duration of HTTP requests in seconds", p.durations)
+	writeHistograms(buf, p.name("response_size_bytes"), "Size of HTTP responses in bytes", p.sizes)
+
+	name = p.name("requests_in_flight")
+	writeHeader(buf, name, "gauge", "Number of HTTP requests currently being handled")
+	for _, l := range sortedLabels(p.inFlight) {
+		fmt.Fprintf(buf, "%s%s %s\n", name, l.format(false, ""), formatFloat(p.inFlight[l]))
+	}
+	return buf.Bytes()
+}
+
+// name returns the metric name with the namespace
+func (p *PrometheusMetrics) name(metric string) string {
+	if p.Namespace == "" {
+		return metric
+	}
+	return p.Namespace + "_" + metric
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistograms writes the bucket, sum and count series of each histogram
+func writeHistograms(buf *bytes.Buffer, name, help string, histograms map[promLabels]*histogram) {
+	writeHeader(buf, name, "histogram", help)
+	labels := make(byLabels, 0, len(histograms))
+	for l := range histograms {
+		labels = append(labels, l)
+	}
+	sort.Sort(labels)
+	for _, l := range labels {
+		h := histograms[l]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", name, l.format(true, formatFloat(upper)), h.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", name, l.format(true, "+Inf"), h.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", name, l.format(true, ""), formatFloat(h.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", name, l.format(true, ""), h.count)
+	}
+}
+
+// format writes the labels as {method="GET",route="/",status="200",le="0.1"}
+func (l promLabels) format(status bool, le string) string {
+	parts := []string{`method="` + escapeLabel(l.method) + `"`, `route="` + escapeLabel(l.route) + `"`}
+	if status {
+		parts = append(parts, `status="`+escapeLabel(l.status)+`"`)
+	}
+	if le != "" {
+		parts = append(parts, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabel escapes backslashes, double quotes and new lines in a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedLabels returns the labels of values in a stable order
+func sortedLabels(values map[promLabels]float64) []promLabels {
+	labels := make(byLabels, 0, len(values))
+	for l := range values {
+		labels = append(labels, l)
+	}
+	sort.Sort(labels)
+	return labels
+}
+
+// byLabels sorts labels by method, route then status
+type byLabels []promLabels
+
+func (s byLabels) Len() int      { return len(s) }
+func (s byLabels) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLabels) Less(i, j int) bool {
+	if s[i].method != s[j].method {
+		return s[i].method < s[j].method
+	}
+	if s[i].route != s[j].route {
+		return s[i].route < s[j].route
+	}
+	return s[i].status < s[j].status
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics using the default buckets with each metric name prefixed by
+// namespace
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		Namespace:       namespace,
+		DurationBuckets: DefaultDurationBuckets,
+		SizeBuckets:     DefaultSizeBuckets,
+		requests:        make(map[promLabels]float64),
+		durations:       make(map[promLabels]*histogram),
+		sizes:           make(map[promLabels]*histogram),
+		inFlight:        make(map[promLabels]float64),
+		paths:           make(map[string]bool),
+	}
+}
+
+// PrometheusHandler returns a http.Handler that wraps h and records the count, duration, response size and number of
+// in flight requests in metrics
+//
+// Example:
+//
+//  r := mux.NewRouter()
+//  r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//  	w.Write([]byte("This is a catch-all route"))
+//  })
+//  metrics := handlers.NewPrometheusMetrics("http")
+//  metrics.DurationBuckets = []float64{0.1, 0.5, 1}
+//  http.Handle("/metrics", metrics.MetricsHandler())
+//  http.Handle("/", handlers.PrometheusHandler(metrics, r))
+//  http.ListenAndServe(":1123", nil)
+func PrometheusHandler(metrics *PrometheusMetrics, h http.Handler) http.Handler {
+	return prometheusHandler{metrics, h}
+}
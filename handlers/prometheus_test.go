@@ -0,0 +1,197 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusHandlerRecordsRequests(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	metrics.DurationBuckets = []float64{60}
+	metrics.SizeBuckets = []float64{1, 100}
+
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	cases := map[string]struct {
+		handler http.Handler
+		method  string
+		url     string
+	}{
+		"ok":        {okHandler, "GET", "http://example.com/"},
+		"ok again":  {okHandler, "GET", "http://example.com/"},
+		"post":      {okHandler, "POST", "http://example.com/items"},
+		"not found": {notFound, "GET", "http://example.com/missing"},
+	}
+
+	for k, tc := range cases {
+		rec := httptest.NewRecorder()
+		PrometheusHandler(metrics, tc.handler).ServeHTTP(rec, newRequest(tc.method, tc.url))
+		assert.NotEqual(t, 0, rec.Code, "test: %s", k)
+	}
+
+	out := string(metrics.Expose())
+	expected := []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",route="/",status="200"} 2`,
+		`http_requests_total{method="GET",route="/missing",status="404"} 1`,
+		`http_requests_total{method="POST",route="/items",status="200"} 1`,
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_bucket{method="GET",route="/",status="200",le="60"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/",status="200",le="+Inf"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/",status="200"} 2`,
+		"# TYPE http_response_size_bytes histogram",
+		`http_response_size_bytes_bucket{method="GET",route="/",status="200",le="1"} 0`,
+		`http_response_size_bytes_bucket{method="GET",route="/",status="200",le="100"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="/",status="200"} 6`,
+		"# TYPE http_requests_in_flight gauge",
+		`http_requests_in_flight{method="GET",route="/"} 0`,
+	}
+	for _, line := range expected {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestPrometheusHandlerInFlight(t *testing.T) {
+	metrics := NewPrometheusMetrics("")
+	var during string
+	handler := PrometheusHandler(metrics, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = string(metrics.Expose())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/"))
+
+	assert.Contains(t, during, `requests_in_flight{method="GET",route="/"} 1`)
+	assert.Contains(t, string(metrics.Expose()), `requests_in_flight{method="GET",route="/"} 0`)
+}
+
+func TestPrometheusRoute(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	metrics.Route = func(r *http.Request) string {
+		return "/items/{id}"
+	}
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/items/1"))
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/items/2"))
+
+	assert.Contains(t, string(metrics.Expose()), `http_requests_total{method="GET",route="/items/{id}",status="200"} 2`)
+}
+
+func TestPrometheusDefaultRouteCollapsesIDs(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/items/1"))
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/items/2"))
+
+	assert.Contains(t, string(metrics.Expose()), `http_requests_total{method="GET",route="/items/{id}",status="200"} 2`)
+}
+
+func TestPrometheusDefaultRouteIsBounded(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	metrics.MaxRoutes = 2
+	for _, path := range []string{"/a", "/b", "/c", "/a", "/d"} {
+		PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com"+path))
+	}
+
+	out := string(metrics.Expose())
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/a",status="200"} 2`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/b",status="200"} 1`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="other",status="200"} 2`+"\n")
+	assert.NotContains(t, out, `route="/c"`)
+}
+
+func TestPrometheusSetRoute(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	metrics.MaxRoutes = 1
+	handler := PrometheusHandler(metrics, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r, "/items/{name}")
+		w.Write([]byte("ok\n"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/items/a"))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/items/b"))
+
+	assert.Contains(t, string(metrics.Expose()), `http_requests_total{method="GET",route="/items/{name}",status="200"} 2`)
+}
+
+func TestPrometheusUnsortedBuckets(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	metrics.SizeBuckets = []float64{1000, 1, 100, 1}
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/"))
+
+	out := string(metrics.Expose())
+	bounds := []string{`le="1"} 0`, `le="100"} 1`, `le="1000"} 1`, `le="+Inf"} 1`}
+	last := -1
+	for _, bound := range bounds {
+		i := strings.Index(out, `http_response_size_bytes_bucket{method="GET",route="/",status="200",`+bound+"\n")
+		if assert.True(t, i > last, "%s follows the previous bucket", bound) {
+			last = i
+		}
+	}
+	assert.Equal(t, 1, strings.Count(out, `http_response_size_bytes_bucket{method="GET",route="/",status="200",le="1"}`))
+}
+
+func TestPrometheusMetricsWithoutConstructor(t *testing.T) {
+	metrics := &PrometheusMetrics{Namespace: "x", SizeBuckets: []float64{100}}
+	assert.NotPanics(t, func() {
+		PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/"))
+	})
+
+	out := string(metrics.Expose())
+	assert.Contains(t, out, `x_requests_total{method="GET",route="/",status="200"} 1`+"\n")
+	assert.Contains(t, out, `x_request_duration_seconds_count{method="GET",route="/",status="200"} 1`+"\n")
+	assert.Contains(t, out, `x_response_size_bytes_bucket{method="GET",route="/",status="200",le="100"} 1`+"\n")
+}
+
+func TestPrometheusBucketsChangedAfterRequests(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	metrics.SizeBuckets = []float64{100}
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/"))
+
+	metrics.SizeBuckets = []float64{1, 10, 100}
+	assert.NotPanics(t, func() {
+		PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/"))
+	})
+
+	out := string(metrics.Expose())
+	assert.Contains(t, out, `http_response_size_bytes_bucket{method="GET",route="/",status="200",le="100"} 2`+"\n")
+	assert.NotContains(t, out, `http_response_size_bytes_bucket{method="GET",route="/",status="200",le="1"}`)
+}
+
+func TestPrometheusMetricsHandler(t *testing.T) {
+	metrics := NewPrometheusMetrics("http")
+	PrometheusHandler(metrics, okHandler).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/"))
+
+	rec := httptest.NewRecorder()
+	metrics.MetricsHandler().ServeHTTP(rec, newRequest("GET", "http://example.com/metrics"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	assert.Equal(t, string(metrics.Expose()), rec.Body.String())
+}
+
+func TestEscapeLabel(t *testing.T) {
+	cases := map[string]struct {
+		value, expected string
+	}{
+		"plain":     {"/items", "/items"},
+		"quote":     {`a"b`, `a\"b`},
+		"backslash": {`a\b`, `a\\b`},
+		"new line":  {"a\nb", `a\nb`},
+	}
+
+	for k, tc := range cases {
+		assert.Equal(t, tc.expected, escapeLabel(tc.value), "test: %s", k)
+	}
+}
@@ -0,0 +1,46 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+/*
+Package ratelimit is a http.Handler middleware that limits the rate of requests made by each client
+
+Requests are limited using a token bucket per key. A Limit of 100 requests per minute with a Burst of 20 allows 20
+requests at once, then another request every 600ms.
+
+    limiter := ratelimit.New(
+        ratelimit.Limit{Requests: 100, Period: time.Minute, Burst: 20},
+        ratelimit.ByIP(),
+        failure.HandlerFunc(onError),
+    )
+    http.ListenAndServe(":80", limiter.Then(router))
+
+When a client exceeds the limit the OnError handler is called with http.StatusTooManyRequests and a
+*LimitExceededError. Every limited response includes the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+headers, and Retry-After is added when the limit is exceeded.
+
+Keys
+
+The key function decides which client a request belongs to. Requests with no key are not limited.
+
+    ratelimit.ByIP()                // X-Forwarded-For from trusted proxies, then the remote address
+    ratelimit.ByHeader("X-Client")  // the value of a header
+    ratelimit.ByUser(nil)           // the user stored by the auth handlers
+    ratelimit.FirstOf(ratelimit.ByUser(nil), ratelimit.ByIP())
+
+ByUser must be placed after an authentication handler:
+
+    http.Handle("/", keyAuth.Then(limiter.Then(router)))
+
+Stores
+
+The state of each key is kept in a Store. New uses a MemoryStore, implement Store to share limits between instances.
+If the Store returns an error the request is allowed and the error is logged.
+*/
+package ratelimit
@@ -0,0 +1,100 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/graze/golang-service/handlers"
+	"github.com/graze/golang-service/handlers/auth"
+)
+
+// KeyFunc returns the key to limit a request by, or an empty string if the request should not be limited
+type KeyFunc func(r *http.Request) string
+
+// ByIP limits requests by the ip of the client (see handlers.GetUserIP)
+func ByIP() KeyFunc {
+	return func(r *http.Request) string {
+		ip, err := handlers.GetUserIP(r)
+		if err != nil {
+			return ""
+		}
+		return "ip:" + ip.String()
+	}
+}
+
+// ByHeader limits requests by the value of the header name, requests without the header are not limited
+func ByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); value != "" {
+			return "header:" + name + ":" + value
+		}
+		return ""
+	}
+}
+
+// UserIDer is implemented by users that have a unique id to limit them by
+type UserIDer interface {
+	UserID() string
+}
+
+// ByUser limits requests by the authenticated user (see auth.GetUser), requests without a user are not limited
+//
+// id converts the user into a unique string. If nil the id is the user itself if it is a string, the subject of
+// *auth.Claims, UserID() for a UserIDer or String() for a fmt.Stringer. Requests for a user with no id are limited by
+// ip instead (see ByIP)
+func ByUser(id func(user interface{}) string) KeyFunc {
+	if id == nil {
+		id = userID
+	}
+	byIP := ByIP()
+	return func(r *http.Request) string {
+		user := auth.GetUser(r)
+		if user == nil {
+			return ""
+		}
+		if key := id(user); key != "" {
+			return "user:" + key
+		}
+		return byIP(r)
+	}
+}
+
+// userID returns the id of a user, or an empty string if the user does not have a stable id
+func userID(user interface{}) string {
+	switch u := user.(type) {
+	case string:
+		return u
+	case *auth.Claims:
+		return u.Subject
+	case UserIDer:
+		return u.UserID()
+	case fmt.Stringer:
+		return u.String()
+	}
+	return ""
+}
+
+// FirstOf uses the first of keys that returns a key for the request
+//
+// Usage:
+//  ratelimit.FirstOf(ratelimit.ByUser(nil), ratelimit.ByIP())
+func FirstOf(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, key := range keys {
+			if k := key(r); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
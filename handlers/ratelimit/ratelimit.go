@@ -0,0 +1,173 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/graze/golang-service/log"
+)
+
+// Limit is the number of requests allowed per Period for each key
+//
+// Requests are limited using a token bucket, so Burst requests can be made at once and the bucket refills at a rate of
+// Requests per Period. Burst defaults to Requests
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Validate returns an error if Requests or Period are not positive or Burst is negative
+func (l Limit) Validate() error {
+	if l.Requests <= 0 {
+		return fmt.Errorf("rate limit requests: %d must be greater than 0", l.Requests)
+	}
+	if l.Period <= 0 {
+		return fmt.Errorf("rate limit period: %s must be greater than 0", l.Period)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("rate limit burst: %d must not be negative", l.Burst)
+	}
+	return nil
+}
+
+// capacity returns the size of the token bucket
+func (l Limit) capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate returns the number of tokens added to the bucket per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the state of the bucket for a key after taking a request from it
+type Result struct {
+	// Allowed is true if the request is within the limit
+	Allowed bool
+	// Limit is the maximum number of requests that can be made at once
+	Limit int
+	// Remaining is the number of requests that can be made now
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request will be allowed, 0 if Allowed
+	RetryAfter time.Duration
+}
+
+// LimitExceededError if a client has made too many requests
+type LimitExceededError struct {
+	limit      Limit
+	retryAfter time.Duration
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("rate limit of %d requests per %s exceeded, retry after: %s", e.limit.Requests, e.limit.Period, e.retryAfter)
+}
+
+// Limiter is a http middleware that limits the rate of requests made by each client
+//
+// The client of each request is found using Key, requests with an empty key are not limited
+type Limiter struct {
+	Limit Limit
+	// Key returns the key requests are limited by
+	Key KeyFunc
+	// Store holds the state of each key
+	Store Store
+	// OnError gets called with http.StatusTooManyRequests when a client exceeds the limit
+	OnError failure.Handler
+}
+
+// ThenFunc wraps a http.HandlerFunc with rate limiting
+func (l *Limiter) ThenFunc(fn func(http.ResponseWriter, *http.Request)) http.Handler {
+	return l.Handler(http.HandlerFunc(fn))
+}
+
+// Then wraps a http.Handler with rate limiting
+func (l *Limiter) Then(h http.Handler) http.Handler {
+	return l.Handler(h)
+}
+
+// Handler returns a http.Handler that limits the rate of requests for each key
+//
+// Each response includes the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, requests over the
+// limit also get a Retry-After header. If the Store fails the request is allowed and the error logged
+//
+// Handler panics if the Limit is not valid
+func (l *Limiter) Handler(h http.Handler) http.Handler {
+	if err := l.Limit.Validate(); err != nil {
+		panic(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := l.Key(req)
+		if key == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		result, err := l.Store.Take(key, l.Limit)
+		if err != nil {
+			log.Ctx(req.Context()).With(log.KV{
+				"module": "ratelimit",
+				"tag":    "ratelimit_store_failed",
+			}).Err(err).Error("failed to check the rate limit, allowing request")
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+		if !result.Allowed {
+			retry := seconds(result.RetryAfter)
+			if retry < 1 {
+				retry = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			l.OnError.Handle(w, req, &LimitExceededError{l.Limit, result.RetryAfter}, http.StatusTooManyRequests)
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// seconds returns d in whole seconds, rounded up
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// New creates a Limiter that allows limit requests for each key, using a MemoryStore
+//
+// New panics if limit is not valid (see Limit.Validate), as limits are normally fixed when the service starts
+//
+// Usage:
+//  limiter := ratelimit.New(
+//      ratelimit.Limit{Requests: 100, Period: time.Minute},
+//      ratelimit.FirstOf(ratelimit.ByUser(nil), ratelimit.ByIP()),
+//      failure.HandlerFunc(onError),
+//  )
+//  http.Handle("/", keyAuth.Then(limiter.Then(router)))
+func New(limit Limit, key KeyFunc, onError failure.Handler) *Limiter {
+	if err := limit.Validate(); err != nil {
+		panic(err)
+	}
+	return &Limiter{limit, key, NewMemoryStore(), onError}
+}
@@ -0,0 +1,210 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graze/golang-service/handlers/auth"
+	"github.com/graze/golang-service/handlers/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(t *testing.T, ip string, headers map[string]string) *http.Request {
+	req, err := http.NewRequest("GET", "/path", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = ip + ":1234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+})
+
+func TestLimiter(t *testing.T) {
+	cases := map[string]struct {
+		limit    Limit
+		requests int
+		status   int
+		headers  map[string]string
+	}{
+		"within limit": {
+			Limit{Requests: 3, Period: time.Minute},
+			3,
+			http.StatusOK,
+			map[string]string{"RateLimit-Limit": "3", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": ""},
+		},
+		"over limit": {
+			Limit{Requests: 3, Period: time.Minute},
+			4,
+			http.StatusTooManyRequests,
+			map[string]string{"RateLimit-Limit": "3", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": "20"},
+		},
+		"burst": {
+			Limit{Requests: 1, Period: time.Second, Burst: 5},
+			2,
+			http.StatusOK,
+			map[string]string{"RateLimit-Limit": "5", "RateLimit-Remaining": "3", "RateLimit-Reset": "2"},
+		},
+	}
+
+	for k, tc := range cases {
+		var limitErr error
+		limiter := New(tc.limit, ByIP(), failure.HandlerFunc(func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			limitErr = err
+			w.WriteHeader(status)
+		}))
+		now := time.Now()
+		limiter.Store.(*MemoryStore).now = func() time.Time { return now }
+		handler := limiter.Then(okHandler)
+
+		var rec *httptest.ResponseRecorder
+		for i := 0; i < tc.requests; i++ {
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, newRequest(t, "10.0.0.1", nil))
+		}
+
+		assert.Equal(t, tc.status, rec.Code, "test: %s", k)
+		for h, v := range tc.headers {
+			assert.Equal(t, v, rec.Header().Get(h), "test: %s header: %s", k, h)
+		}
+		if tc.status == http.StatusTooManyRequests {
+			assert.IsType(t, &LimitExceededError{}, limitErr, "test: %s", k)
+		}
+	}
+}
+
+func TestLimiterRefills(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Second}
+
+	for i := 0; i < 2; i++ {
+		result, _ := store.Take("key", limit)
+		assert.True(t, result.Allowed)
+	}
+	result, _ := store.Take("key", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	result, _ = store.Take("key", limit)
+	assert.True(t, result.Allowed, "a token is added every 500ms")
+
+	result, _ = store.Take("other", limit)
+	assert.True(t, result.Allowed, "keys are limited separately")
+}
+
+type idUser struct{ id string }
+
+func (u *idUser) UserID() string { return u.id }
+
+type stringUser string
+
+func (u stringUser) String() string { return string(u) }
+
+func TestLimiterKeys(t *testing.T) {
+	withUser := func(r *http.Request, user interface{}) *http.Request {
+		var out *http.Request
+		auth.NewXAPIKey(auth.FinderFunc(func(c interface{}, r *http.Request) (interface{}, error) {
+			return user, nil
+		}), nil).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			out = r
+		}).ServeHTTP(httptest.NewRecorder(), r)
+		return out
+	}
+
+	cases := map[string]struct {
+		key      KeyFunc
+		request  *http.Request
+		expected string
+	}{
+		"ip":                   {ByIP(), newRequest(t, "10.0.0.1", nil), "ip:10.0.0.1"},
+		"forwarded ip":         {ByIP(), newRequest(t, "10.0.0.1", map[string]string{"X-Forwarded-For": "10.0.0.2"}), "ip:10.0.0.2"},
+		"invalid ip":           {ByIP(), newRequest(t, "nope", nil), ""},
+		"header":               {ByHeader("X-Client"), newRequest(t, "10.0.0.1", map[string]string{"X-Client": "app"}), "header:X-Client:app"},
+		"missing header":       {ByHeader("X-Client"), newRequest(t, "10.0.0.1", nil), ""},
+		"user":                 {ByUser(nil), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), "bob"), "user:bob"},
+		"user id":              {ByUser(func(u interface{}) string { return "id" }), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), "bob"), "user:id"},
+		"claims":               {ByUser(nil), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), &auth.Claims{Subject: "bob"}), "user:bob"},
+		"user ider":            {ByUser(nil), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), &idUser{"bob"}), "user:bob"},
+		"stringer":             {ByUser(nil), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), stringUser("bob")), "user:bob"},
+		"user without an id":   {ByUser(nil), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), &struct{ name string }{"bob"}), "ip:10.0.0.1"},
+		"empty id":             {ByUser(func(u interface{}) string { return "" }), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), "bob"), "ip:10.0.0.1"},
+		"no user":              {ByUser(nil), newRequest(t, "10.0.0.1", nil), ""},
+		"first of with user":   {FirstOf(ByUser(nil), ByIP()), withUser(newRequest(t, "10.0.0.1", map[string]string{"X-Api-Key": "k"}), "bob"), "user:bob"},
+		"first of without one": {FirstOf(ByUser(nil), ByIP()), newRequest(t, "10.0.0.1", nil), "ip:10.0.0.1"},
+	}
+
+	for k, tc := range cases {
+		assert.Equal(t, tc.expected, tc.key(tc.request), "test: %s", k)
+	}
+}
+
+type failingStore struct{}
+
+func (s failingStore) Take(key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("store unavailable")
+}
+
+func TestLimiterAllowsRequestsWhenTheStoreFails(t *testing.T) {
+	limiter := &Limiter{Limit{Requests: 1, Period: time.Second}, ByIP(), failingStore{}, nil}
+	rec := httptest.NewRecorder()
+	limiter.Then(okHandler).ServeHTTP(rec, newRequest(t, "10.0.0.1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestLimiterIgnoresRequestsWithoutAKey(t *testing.T) {
+	limiter := New(Limit{Requests: 1, Period: time.Second}, ByHeader("X-Client"), nil)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		limiter.Then(okHandler).ServeHTTP(rec, newRequest(t, "10.0.0.1", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestLimitValidate(t *testing.T) {
+	cases := map[string]struct {
+		limit Limit
+		valid bool
+	}{
+		"valid":             {Limit{Requests: 1, Period: time.Second}, true},
+		"valid with burst":  {Limit{Requests: 1, Period: time.Second, Burst: 5}, true},
+		"zero period":       {Limit{Requests: 1}, false},
+		"negative period":   {Limit{Requests: 1, Period: -time.Second}, false},
+		"zero requests":     {Limit{Period: time.Second}, false},
+		"negative requests": {Limit{Requests: -1, Period: time.Second}, false},
+		"negative burst":    {Limit{Requests: 1, Period: time.Second, Burst: -1}, false},
+	}
+
+	for k, tc := range cases {
+		err := tc.limit.Validate()
+		assert.Equal(t, tc.valid, err == nil, "test: %s - %v", k, err)
+		if tc.valid {
+			assert.NotPanics(t, func() { New(tc.limit, ByIP(), nil) }, "test: %s", k)
+		} else {
+			assert.Panics(t, func() { New(tc.limit, ByIP(), nil) }, "test: %s", k)
+			limiter := &Limiter{tc.limit, ByIP(), NewMemoryStore(), nil}
+			assert.Panics(t, func() { limiter.Then(okHandler) }, "test: %s", k)
+		}
+	}
+}
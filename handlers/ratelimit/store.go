@@ -0,0 +1,93 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Store holds the token buckets of each key
+//
+// Implement this to share limits between multiple instances of a service (redis, memcached, etc)
+type Store interface {
+	// Take removes a request from the bucket of key, returning the state of the bucket afterwards
+	Take(key string, limit Limit) (Result, error)
+}
+
+// MemoryStore is a Store that keeps the buckets in memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// bucket is the number of tokens available to a key at a point in time
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Take removes a request from the bucket of key
+func (s *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	capacity, rate := float64(limit.capacity()), limit.rate()
+	s.sweep(now, limit)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{capacity, now}
+		s.buckets[key] = b
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+
+	result := Result{Limit: limit.capacity()}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = duration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = duration((capacity - b.tokens) / rate)
+	return result, nil
+}
+
+// sweep removes buckets that have refilled, at most once per Period
+func (s *MemoryStore) sweep(now time.Time, limit Limit) {
+	if now.Sub(s.lastSweep) < limit.Period {
+		return
+	}
+	s.lastSweep = now
+	capacity, rate := float64(limit.capacity()), limit.rate()
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= capacity {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// duration converts a number of seconds to a time.Duration
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -12,11 +12,9 @@ package handlers
 
 import (
 	"bufio"
-	"fmt"
 	"net"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/aristanetworks/goarista/monotime"
@@ -173,28 +171,15 @@ func uriPath(req *http.Request, url url.URL) (uri string) {
 	return
 }
 
-// getUserIP takes a request and extracts the users ip, using `X-Forwarded-For` and `X-Real-Ip` headers
-// then the `req.RemoteAddr`
+// GetUserIP returns the ip of the user making req using the DefaultClientIPResolver
+//
+// The forwarding header (`X-Forwarded-For` by default) is only used if the request comes from a trusted proxy,
+// otherwise it is `req.RemoteAddr`
+func GetUserIP(req *http.Request) (net.IP, error) {
+	return getUserIP(req)
+}
+
+// getUserIP takes a request and extracts the users ip using the DefaultClientIPResolver
 func getUserIP(req *http.Request) (net.IP, error) {
-	for _, h := range []string{"X-Forwarded-For", "X-Real-Ip"} {
-		if req.Header.Get(h) != "" {
-			for _, ip := range strings.Split(req.Header.Get(h), ",") {
-				// header can contain spaces too, strip those out.
-				userIP := net.ParseIP(strings.Replace(ip, " ", "", -1))
-				if userIP == nil {
-					return nil, fmt.Errorf("getUserIP: %q is not a valid IP", ip)
-				}
-				return userIP, nil
-			}
-		}
-	}
-	ip, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		return nil, fmt.Errorf("getUserIP: %q is not a valid IP:Port", req.RemoteAddr)
-	}
-	userIP := net.ParseIP(ip)
-	if userIP == nil {
-		return nil, fmt.Errorf("getUserIP: %q is not a valid IP:port", req.RemoteAddr)
-	}
-	return userIP, nil
+	return DefaultClientIPResolver.ClientIP(req)
 }
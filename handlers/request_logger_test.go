@@ -87,9 +87,11 @@ func TestGetUserIP(t *testing.T) {
 
 	singleHeader := newRequest("GET", "http://example.com")
 	singleHeader.Header.Add("X-Forwarded-For", "192.168.100.5")
+	singleHeader.RemoteAddr = "10.0.0.1:1234"
 
 	multipleHeader := newRequest("GET", "http://example.com")
 	multipleHeader.Header.Add("X-Forwarded-For", "192.168.100.5, 192.168.100.12")
+	multipleHeader.RemoteAddr = "10.0.0.1:1234"
 
 	cases := map[string]struct {
 		req      *http.Request
@@ -0,0 +1,97 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/graze/golang-service/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RequestIDHeader is the header a request id is read from and written to
+const RequestIDHeader = "X-Request-Id"
+
+// MaxRequestIDLength is the longest inbound request id that is accepted
+const MaxRequestIDLength = 128
+
+// contextKey is a type to ensure unique keys for values stored in a context by this package
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	traceKey
+	holderKey
+)
+
+type requestIDHandler struct {
+	handler http.Handler
+}
+
+// ServeHTTP stores the request id in the request context and response header
+func (h requestIDHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id := req.Header.Get(RequestIDHeader)
+	if !ValidRequestID(id) {
+		id = uuid.NewV4().String()
+	}
+	w.Header().Set(RequestIDHeader, id)
+
+	ctx := context.WithValue(req.Context(), requestIDKey, id)
+	ctx = log.Ctx(ctx).With(log.KV{"transaction": id}).NewContext(ctx)
+	h.handler.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// ValidRequestID returns true if id is between 1 and MaxRequestIDLength characters of letters, digits and `-_.:+/=`
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+', c == '/', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the request id stored in ctx by RequestIDHandler, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// GetRequestID returns the request id of req stored by RequestIDHandler, or an empty string
+//
+// Usage:
+//  func GetList(w http.ResponseWriter, r *http.Request) {
+//      downstream.Header.Set(handlers.RequestIDHeader, handlers.GetRequestID(r))
+//  }
+func GetRequestID(req *http.Request) string {
+	return RequestIDFromContext(req.Context())
+}
+
+// RequestIDHandler returns a handler that gives every request an id
+//
+// An inbound X-Request-Id header is used if it is valid (see ValidRequestID), otherwise a uuid4 is generated. The id
+// is returned in the X-Request-Id response header, can be retrieved with GetRequestID and is used as the
+// `transaction` field of the logging context
+//
+// Usage:
+//  http.ListenAndServe(":1234", handlers.RequestIDHandler(handlers.LoggingContextHandler(log.With(log.KV{}), r)))
+func RequestIDHandler(h http.Handler) http.Handler {
+	return requestIDHandler{h}
+}
@@ -0,0 +1,69 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graze/golang-service/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	t.Parallel()
+
+	uuidRegex := `^(?:[0-9a-z]+-){4}[0-9a-z]+$`
+
+	cases := map[string]struct {
+		header   string
+		expected string
+		regex    string
+	}{
+		"no header":        {"", "", uuidRegex},
+		"valid header":     {"abc-123_x.y:z", "abc-123_x.y:z", ""},
+		"base64 header":    {"YWJj+/=", "YWJj+/=", ""},
+		"invalid chars":    {"abc 123", "", uuidRegex},
+		"header injection": {"abc\r\nSet-Cookie: x", "", uuidRegex},
+		"too long":         {strings.Repeat("a", MaxRequestIDLength+1), "", uuidRegex},
+		"max length":       {strings.Repeat("a", MaxRequestIDLength), strings.Repeat("a", MaxRequestIDLength), ""},
+	}
+
+	for k, tc := range cases {
+		var id, transaction string
+		handler := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id = GetRequestID(r)
+			transaction, _ = log.Ctx(r.Context()).Fields()["transaction"].(string)
+		}))
+		req := newRequest("GET", "http://example.com")
+		if tc.header != "" {
+			req.Header[RequestIDHeader] = []string{tc.header}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if tc.regex != "" {
+			assert.Regexp(t, tc.regex, id, "test: %s", k)
+		} else {
+			assert.Equal(t, tc.expected, id, "test: %s", k)
+		}
+		assert.Equal(t, id, rec.Header().Get(RequestIDHeader), "test: %s", k)
+		assert.Equal(t, id, transaction, "test: %s", k)
+	}
+}
+
+func TestRequestIDFromContextWithoutAnID(t *testing.T) {
+	assert.Equal(t, "", RequestIDFromContext(context.Background()))
+	assert.Equal(t, "", GetRequestID(newRequest("GET", "http://example.com")))
+}
@@ -16,41 +16,111 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/graze/golang-service/log"
 	"github.com/graze/golang-service/metrics"
 )
 
+// StatsdOptions configure the metrics sent by the statsd handler
+type StatsdOptions struct {
+	// ResponseTimeMetric is the name of the response time timing. Defaults to request.response_time
+	ResponseTimeMetric string
+	// CountMetric is the name of the request counter. Defaults to request.count
+	CountMetric string
+	// SizeMetric is the name of a histogram of response sizes in bytes. It is only sent if set
+	SizeMetric string
+	// SampleRate is the sample rate of every metric between 0 and 1. Defaults to 1
+	SampleRate float64
+	// StatusClass adds a statusClass:2xx tag alongside the statusCode tag
+	StatusClass bool
+	// Tags are added to every metric
+	Tags []string
+	// RequestTags returns extra tags for a request and its response status
+	RequestTags func(req *http.Request, status int) []string
+	// Paths normalises the endpoint tag. The raw path is used if it is nil
+	Paths *PathNormaliser
+}
+
+// tags returns the tags for a request
+func (o StatsdOptions) tags(req *http.Request, url url.URL, status int) []string {
+	tags := []string{
+		"endpoint:" + o.Paths.normalise(req, url),
+		"statusCode:" + strconv.Itoa(status),
+		"method:" + req.Method,
+		"protocol:" + req.Proto,
+	}
+	if o.StatusClass {
+		tags = append(tags, "statusClass:"+strconv.Itoa(status/100)+"xx")
+	}
+	tags = append(tags, o.Tags...)
+	if o.RequestTags != nil {
+		tags = append(tags, o.RequestTags(req, status)...)
+	}
+	if holder := getRequestHolder(req); holder != nil {
+		tags = append(tags, holder.tags...)
+	}
+	return tags
+}
+
 type statsdHandler struct {
-	statsd  *statsd.Client
+	statsd  metrics.Client
+	options StatsdOptions
 	handler http.Handler
 }
 
 // ServeHTTP does the actual handling of HTTP requests by wrapping the request in a logger
 func (h statsdHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	LogServeHTTP(w, req, h.handler, h.writeLog)
+	LogServeHTTP(w, withRequestHolder(req), h.handler, h.writeLog)
 }
 
 // writeLog writes the log do the statsd client from a statsdHandler
 func (h statsdHandler) writeLog(w LoggingResponseWriter, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
-	writeStatsdLog(h.statsd, req, url, ts, dur, status, size)
+	writeStatsdLog(h.statsd, h.options, req, url, ts, dur, status, size)
 }
 
 // writeStatsdLog send the response time and a counter for each request to statsd
-func writeStatsdLog(w *statsd.Client, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
-	uri := uriPath(req, url)
+//
+// The metric names, tags and sample rate are set by options
+func writeStatsdLog(w metrics.Client, options StatsdOptions, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
+	tags := options.tags(req, url, status)
 
-	tags := []string{
-		"endpoint:" + uri,
-		"statusCode:" + strconv.Itoa(status),
-		"method:" + req.Method,
-		"protocol:" + req.Proto,
+	rate := options.SampleRate
+	if rate <= 0 {
+		rate = 1
+	}
+	timing := options.ResponseTimeMetric
+	if timing == "" {
+		timing = "request.response_time"
+	}
+	count := options.CountMetric
+	if count == "" {
+		count = "request.count"
 	}
 
-	w.Timing("request.response_time", dur, tags, 1)
-	w.Incr("request.count", tags, 1)
+	w.Timing(timing, dur, tags, rate)
+	w.Incr(count, tags, rate)
+	if options.SizeMetric != "" {
+		w.Histogram(options.SizeMetric, float64(size), tags, rate)
+	}
 }
 
-// StatsdIoHandler returns a http.Handler that wraps h and logs request to statsd
+// AddStatsdTags adds tags to the metrics sent by the statsd handler for req
+//
+// This lets handlers further down the chain add tags for values that are only known to them, such as the
+// authenticated user. It does nothing if req is not handled by a statsd handler
+//
+// Usage:
+//  func GetList(w http.ResponseWriter, r *http.Request) {
+//      handlers.AddStatsdTags(r, "tier:"+auth.GetUser(r).(*User).Tier)
+//  }
+func AddStatsdTags(req *http.Request, tags ...string) {
+	if holder := getRequestHolder(req); holder != nil {
+		holder.tags = append(holder.tags, tags...)
+	}
+}
+
+// StatsdIoHandler returns a http.Handler that wraps h and logs request to a metrics client
+//
+// A *statsd.Client from datadog-go can be used as the client directly, and metrics.NewRecorder can be used in tests
 //
 // Example:
 //
@@ -58,29 +128,85 @@ func writeStatsdLog(w *statsd.Client, req *http.Request, url url.URL, ts time.Ti
 //  r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 //  	w.Write([]byte("This is a catch-all route"))
 //  })
-//  c, err := statsd.New("127.0.0.1:8125")
-//  loggedRouter := handlers.StatsdHandler(c, r)
+//  c, err := metrics.NewClient(metrics.StatsdClientConf{Host: "127.0.0.1", Port: "8125"})
+//  loggedRouter := handlers.StatsdIoHandler(c, r)
 //  http.ListenAndServe(":1123", loggedRouter)
 //
-func StatsdIoHandler(out *statsd.Client, h http.Handler) http.Handler {
-	return statsdHandler{out, h}
+func StatsdIoHandler(out metrics.Client, h http.Handler) http.Handler {
+	return statsdHandler{out, StatsdOptions{}, h}
+}
+
+// StatsdIoHandlerWithPaths returns a StatsdIoHandler that tags each request with the endpoint normalised by paths
+// instead of the raw path, to limit the number of series created
+//
+// Usage:
+//  paths := handlers.NewPathNormaliser("/", "/users", "/users/{id}")
+//  loggedRouter := handlers.StatsdIoHandlerWithPaths(c, paths, r)
+//  // GET /users/123 -> endpoint:/users/{id}, GET /unknown -> endpoint:other
+func StatsdIoHandlerWithPaths(out metrics.Client, paths *PathNormaliser, h http.Handler) http.Handler {
+	return StatsdIoHandlerWithOptions(out, StatsdOptions{Paths: paths}, h)
+}
+
+// StatsdIoHandlerWithOptions returns a StatsdIoHandler with the metric names, tags and sample rate set by options
+//
+// Usage:
+//  loggedRouter := handlers.StatsdIoHandlerWithOptions(c, handlers.StatsdOptions{
+//      ResponseTimeMetric: "http.response_time",
+//      CountMetric:        "http.count",
+//      SizeMetric:         "http.response_size",
+//      SampleRate:         0.5,
+//      StatusClass:        true,
+//      Tags:               []string{"service:api"},
+//      RequestTags: func(r *http.Request, status int) []string {
+//          return []string{"client:" + r.Header.Get("X-Client")}
+//      },
+//  }, r)
+func StatsdIoHandlerWithOptions(out metrics.Client, options StatsdOptions, h http.Handler) http.Handler {
+	return statsdHandler{out, options, h}
 }
 
 // NewStatsdHandler returns a handlers.StatsdHandler to write request and response informtion to statsd
 //
+// If c is not valid the error is logged and no metrics are sent. To handle the error yourself create the client with
+// metrics.NewClient and use StatsdIoHandler
+//
 // Usage:
 // 	r := mux.NewRouter()
 // 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 // 	   w.Write([]byte("This is a catch-all route"))
 // 	})
-// 	loggedRouter := handlers.NewStatsdHandler(c)
+// 	loggedRouter := handlers.NewStatsdHandler(c)(r)
 // 	http.ListenAndServe(":1123", loggedRouter)
 func NewStatsdHandler(c metrics.StatsdClientConf) func(h http.Handler) http.Handler {
+	return newStatsdHandler(c, metrics.ClientOptions{}, StatsdOptions{})
+}
+
+// newStatsdHandler returns a function creating a statsd handler with a client configured by c and clientOptions that
+// sends the metrics set by options
+func newStatsdHandler(c metrics.StatsdClientConf, clientOptions metrics.ClientOptions, options StatsdOptions) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
-		client, err := metrics.GetStatsd(c)
+		client, err := metrics.NewClientWith(c, clientOptions)
 		if err != nil {
-			panic(err)
+			log.With(log.KV{
+				"module": "request.handler",
+				"tag":    "statsd_config_invalid",
+			}).Err(err).Error("invalid statsd configuration, no request metrics will be sent")
+			client = metrics.Noop{}
 		}
-		return StatsdIoHandler(client, h)
+		return StatsdIoHandlerWithOptions(client, options, h)
 	}
 }
+
+// StatsdHandler returns a http.Handler that wraps h and logs requests to a statsd client configured using the
+// STATSD_* environment variables (see metrics.LoadStatsdConf and metrics.LoadClientOptions)
+//
+// Usage:
+// 	r := mux.NewRouter()
+// 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+// 	   w.Write([]byte("This is a catch-all route"))
+// 	})
+// 	loggedRouter := handlers.StatsdHandler(r)
+// 	http.ListenAndServe(":1123", loggedRouter)
+func StatsdHandler(h http.Handler) http.Handler {
+	return newStatsdHandler(metrics.StatsdConfFromEnv(), metrics.ClientOptionsFromEnv(), StatsdOptions{})(h)
+}
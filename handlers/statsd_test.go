@@ -100,7 +100,7 @@ func TestStatsdLogging(t *testing.T) {
 	client.Namespace = "service.logging.live."
 
 	for k, tc := range cases {
-		writeStatsdLog(client, tc.request, *tc.request.URL, tc.timestamp, tc.duration, http.StatusOK, 100)
+		writeStatsdLog(client, StatsdOptions{}, tc.request, *tc.request.URL, tc.timestamp, tc.duration, http.StatusOK, 100)
 		for _, message := range tc.expected {
 			assert.Equal(t, message, <-done, "test: %s", k)
 		}
@@ -152,3 +152,88 @@ func TestStatsdHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestStatsdIoHandlerWithRecorder(t *testing.T) {
+	recorder := metrics.NewRecorder()
+	handler := StatsdIoHandler(recorder, okHandler)
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com/path"))
+
+	tags := []string{"endpoint:/path", "statusCode:200", "method:GET", "protocol:HTTP/1.1"}
+	timings := recorder.Find("request.response_time")
+	if assert.Len(t, timings, 1) {
+		assert.Equal(t, metrics.TimingType, timings[0].Type)
+		assert.Equal(t, tags, timings[0].Tags)
+	}
+	assert.Equal(t, []metrics.Metric{{Type: metrics.CountType, Name: "request.count", Value: 1, Tags: tags, Rate: 1}}, recorder.Find("request.count"))
+}
+
+func TestStatsdIoHandlerWithOptions(t *testing.T) {
+	created := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddStatsdTags(r, "tier:gold")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created\n"))
+	})
+	base := []string{"endpoint:/path", "statusCode:201", "method:GET", "protocol:HTTP/1.1"}
+
+	cases := map[string]struct {
+		options  StatsdOptions
+		timing   string
+		count    string
+		tags     []string
+		rate     float64
+		expected []metrics.Metric
+	}{
+		"defaults": {
+			StatsdOptions{},
+			"request.response_time", "request.count",
+			append(base, "tier:gold"), 1,
+			nil,
+		},
+		"renamed with size": {
+			StatsdOptions{ResponseTimeMetric: "http.time", CountMetric: "http.count", SizeMetric: "http.size"},
+			"http.time", "http.count",
+			append(base, "tier:gold"), 1,
+			[]metrics.Metric{{Type: metrics.HistogramType, Name: "http.size", Value: 8, Tags: append(base, "tier:gold"), Rate: 1}},
+		},
+		"tags and rate": {
+			StatsdOptions{
+				SampleRate:  0.25,
+				StatusClass: true,
+				Tags:        []string{"service:api"},
+				RequestTags: func(r *http.Request, status int) []string {
+					return []string{"client:" + r.Header.Get("X-Client")}
+				},
+			},
+			"request.response_time", "request.count",
+			append(base, "statusClass:2xx", "service:api", "client:web", "tier:gold"), 0.25,
+			nil,
+		},
+	}
+
+	for k, tc := range cases {
+		recorder := metrics.NewRecorder()
+		req := newRequest("GET", "http://example.com/path")
+		req.Header.Set("X-Client", "web")
+		StatsdIoHandlerWithOptions(recorder, tc.options, created).ServeHTTP(httptest.NewRecorder(), req)
+
+		timings := recorder.Find(tc.timing)
+		if assert.Len(t, timings, 1, "test: %s", k) {
+			assert.Equal(t, tc.tags, timings[0].Tags, "test: %s", k)
+			assert.Equal(t, tc.rate, timings[0].Rate, "test: %s", k)
+		}
+		assert.Equal(t, []metrics.Metric{{Type: metrics.CountType, Name: tc.count, Value: 1, Tags: tc.tags, Rate: tc.rate}}, recorder.Find(tc.count), "test: %s", k)
+		if tc.expected != nil {
+			assert.Equal(t, tc.expected, recorder.Find(tc.options.SizeMetric), "test: %s", k)
+		}
+	}
+}
+
+func TestNewStatsdHandlerInvalidConf(t *testing.T) {
+	handler := NewStatsdHandler(metrics.StatsdClientConf{Port: "not a port"})(okHandler)
+
+	rec := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		handler.ServeHTTP(rec, newRequest("GET", "http://example.com"))
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -11,40 +11,124 @@
 package handlers
 
 import (
+	"math/rand"
 	"net/http"
 	"net/url"
+	"path"
 	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/graze/golang-service/log"
 )
 
+// StatusLevel is the level that responses with a status in a range are logged at
+type StatusLevel struct {
+	StatusRange
+	Level logrus.Level
+}
+
+// DefaultStatusLevels logs server errors at the error level and client errors at the warning level
+var DefaultStatusLevels = []StatusLevel{
+	{StatusRange{500, 599}, log.ErrorLevel},
+	{StatusRange{400, 499}, log.WarnLevel},
+}
+
+// StructuredOptions configure the entries logged by the structured log handler
+type StructuredOptions struct {
+	// Paths adds the normalised endpoint of each request as http.endpoint, if set
+	Paths *PathNormaliser
+	// Bodies logs the request and response bodies and headers, if set
+	Bodies *BodyCapture
+	// Levels are the levels responses are logged at, using the first matching status. Other responses are logged at
+	// the info level. See DefaultStatusLevels
+	Levels []StatusLevel
+	// Exclude are patterns of paths that are not logged, using the syntax of path.Match. e.g. /health or /static/*
+	Exclude []string
+	// SuccessSampleRate is the fraction of successful (< 400) responses that are logged. Defaults to 1
+	SuccessSampleRate float64
+	// SlowThreshold logs requests that take longer than it at the warning level or above, even if they are excluded or
+	// not sampled. Ignored if 0
+	SlowThreshold time.Duration
+
+	random func() float64
+}
+
+// level returns the level to log a request at and false if it should not be logged
+func (o StructuredOptions) level(req *http.Request, url url.URL, status int, dur time.Duration) (logrus.Level, bool) {
+	level := log.InfoLevel
+	for _, l := range o.Levels {
+		if status >= l.Min && status <= l.Max {
+			level = l.Level
+			break
+		}
+	}
+
+	if o.SlowThreshold > 0 && dur > o.SlowThreshold {
+		if level > log.WarnLevel {
+			level = log.WarnLevel
+		}
+		return level, true
+	}
+
+	p := uriPath(req, url)
+	for _, pattern := range o.Exclude {
+		if matched, _ := path.Match(pattern, p); matched {
+			return level, false
+		}
+	}
+
+	if status < 400 && o.SuccessSampleRate > 0 && o.SuccessSampleRate < 1 {
+		random := o.random
+		if random == nil {
+			random = rand.Float64
+		}
+		if random() >= o.SuccessSampleRate {
+			return level, false
+		}
+	}
+	return level, true
+}
+
 type structuredHandler struct {
 	logger  log.FieldLogger
+	options StructuredOptions
 	handler http.Handler
 }
 
 // ServeHTTP does the actual handling of HTTP requests by wrapping the request in a logger
 func (h structuredHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	LogServeHTTP(w, req, h.handler, h.writeLog)
-}
-
-// writeLog writes a log entry to structuredHandler's logger
-func (h structuredHandler) writeLog(w LoggingResponseWriter, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
-	writeStructuredLog(w, h.logger.Ctx(req.Context()), req, url, ts, dur, status, size)
+	if h.options.Paths != nil {
+		req = withRequestHolder(req)
+	}
+	var bodies *capturedBodies
+	if h.options.Bodies != nil {
+		w, req, bodies = h.options.Bodies.capture(w, req)
+	}
+	LogServeHTTP(w, req, h.handler, func(w LoggingResponseWriter, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
+		writeStructuredLog(w, h.logger.Ctx(req.Context()), h.options, bodies, req, url, ts, dur, status, size)
+	})
 }
 
 // writeStructuredLog writes a log entry for req to logger in a structured format for json/logfmt
 // ts is the timestamp with wich the entry should be logged
 // dur is the time taken by the server to generate the response
 // status and size are used to provide response HTTP status and size
-func writeStructuredLog(w LoggingResponseWriter, logger log.FieldLogger, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
+// options.Paths adds the normalised endpoint as http.endpoint if it is not nil
+// options.Levels, Exclude, SuccessSampleRate and SlowThreshold choose the level and whether the request is logged
+// bodies adds the captured request and response bodies if it is not nil
+func writeStructuredLog(w LoggingResponseWriter, logger log.FieldLogger, options StructuredOptions, bodies *capturedBodies, req *http.Request, url url.URL, ts time.Time, dur time.Duration, status, size int) {
+	level, ok := options.level(req, url, status, dur)
+	if !ok {
+		return
+	}
+
 	uri := parseURI(req, url)
 	ip := ""
 	if userIP, err := getUserIP(req); err == nil {
 		ip = userIP.String()
 	}
 
-	logger.With(log.KV{
+	fields := log.KV{
 		"tag":             "request_handled",
 		"http.method":     req.Method,
 		"http.protocol":   req.Proto,
@@ -58,7 +142,29 @@ func writeStructuredLog(w LoggingResponseWriter, logger log.FieldLogger, req *ht
 		"http.user-agent": req.Header.Get("User-Agent"),
 		"dur":             dur.Seconds(),
 		"http.time":       ts.Format(time.RFC3339Nano),
-	}).Infof("%s %s %s", req.Method, uri, req.Proto)
+	}
+	if options.Paths != nil {
+		fields["http.endpoint"] = options.Paths.normalise(req, url)
+	}
+	for k, v := range bodies.fields(w, status) {
+		fields[k] = v
+	}
+	if options.SlowThreshold > 0 && dur > options.SlowThreshold {
+		fields["http.slow"] = true
+	}
+
+	entry := logger.With(fields)
+	switch level {
+	case log.PanicLevel, log.FatalLevel, log.ErrorLevel:
+		// a request should never exit or panic the service, so these are logged as errors
+		entry.Errorf("%s %s %s", req.Method, uri, req.Proto)
+	case log.WarnLevel:
+		entry.Warnf("%s %s %s", req.Method, uri, req.Proto)
+	case log.DebugLevel:
+		entry.Debugf("%s %s %s", req.Method, uri, req.Proto)
+	default:
+		entry.Infof("%s %s %s", req.Method, uri, req.Proto)
+	}
 }
 
 // StructuredLogHandler returns a http.Handler that wraps h and logs request to out in
@@ -77,7 +183,36 @@ func writeStructuredLog(w LoggingResponseWriter, logger log.FieldLogger, req *ht
 //		, r)
 //  http.ListenAndServe(":1123", loggedRouter)
 func StructuredLogHandler(logger log.FieldLogger, h http.Handler) http.Handler {
-	return structuredHandler{logger, h}
+	return structuredHandler{logger, StructuredOptions{}, h}
+}
+
+// StructuredLogHandlerWithPaths returns a StructuredLogHandler that also logs the endpoint of each request normalised
+// by paths as http.endpoint
+//
+// Usage:
+//  loggedRouter := handlers.StructuredLogHandlerWithPaths(
+//      log.With(log.KV{"module": "request.handler"}),
+//      handlers.NewPathNormaliser(),
+//      r)
+func StructuredLogHandlerWithPaths(logger log.FieldLogger, paths *PathNormaliser, h http.Handler) http.Handler {
+	return StructuredLogHandlerWithOptions(logger, StructuredOptions{Paths: paths}, h)
+}
+
+// StructuredLogHandlerWithOptions returns a StructuredLogHandler that logs the additional fields set by options
+//
+// Usage:
+//  loggedRouter := handlers.StructuredLogHandlerWithOptions(
+//      log.With(log.KV{"module": "request.handler"}),
+//      handlers.StructuredOptions{
+//          Bodies: &handlers.BodyCapture{
+//              Request:  true,
+//              Response: true,
+//              Statuses: []handlers.StatusRange{{Min: 400, Max: 599}},
+//          },
+//      },
+//      r)
+func StructuredLogHandlerWithOptions(logger log.FieldLogger, options StructuredOptions, h http.Handler) http.Handler {
+	return structuredHandler{logger, options, h}
 }
 
 // StructuredHandler returns an opinionated structuredHandler using the standard logger
@@ -96,5 +231,5 @@ func StructuredHandler(h http.Handler) http.Handler {
 	logger := log.With(log.KV{
 		"module": "request.handler",
 	})
-	return structuredHandler{logger, h}
+	return structuredHandler{logger, StructuredOptions{}, h}
 }
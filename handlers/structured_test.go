@@ -17,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/Sirupsen/logrus/hooks/test"
 	"github.com/graze/golang-service/log"
 	"github.com/stretchr/testify/assert"
@@ -28,6 +29,7 @@ func TestStructuredLogging(t *testing.T) {
 
 	userRequest := newRequest("GET", "http://example.com")
 	userRequest.Header.Add("X-Forwarded-For", "192.168.100.5")
+	userRequest.RemoteAddr = "10.0.0.1:1234"
 
 	userAgentRequest := newRequest("GET", "http://example.com")
 	userAgentRequest.Header.Add("User-Agent", "some user agent")
@@ -232,7 +234,7 @@ func TestStructuredLogging(t *testing.T) {
 		hook.Reset()
 		rec := httptest.NewRecorder()
 		responseLogger := &responseLogger{w: rec}
-		writeStructuredLog(responseLogger, local, tc.request, *tc.request.URL, tc.timestamp, tc.duration, http.StatusOK, tc.size)
+		writeStructuredLog(responseLogger, local, StructuredOptions{}, nil, tc.request, *tc.request.URL, tc.timestamp, tc.duration, http.StatusOK, tc.size)
 		assert.Equal(t, 1, len(hook.Entries), "test %s - Has Log Entry", k)
 		assert.Equal(t, log.InfoLevel, hook.LastEntry().Level, "test %s - Has Log Level", k)
 		assert.Equal(t, tc.message, hook.LastEntry().Message, "test %s - Has Message", k)
@@ -246,3 +248,55 @@ func TestStructuredLogging(t *testing.T) {
 		}
 	}
 }
+
+func TestStructuredLoggingLevelsAndSampling(t *testing.T) {
+	random := func() float64 { return 0.5 }
+
+	cases := map[string]struct {
+		options StructuredOptions
+		path    string
+		status  int
+		dur     time.Duration
+		logged  bool
+		level   logrus.Level
+		slow    bool
+	}{
+		"info by default":              {StructuredOptions{}, "/", 500, time.Millisecond, true, log.InfoLevel, false},
+		"server errors are errors":     {StructuredOptions{Levels: DefaultStatusLevels}, "/", 503, time.Millisecond, true, log.ErrorLevel, false},
+		"client errors are warnings":   {StructuredOptions{Levels: DefaultStatusLevels}, "/", 404, time.Millisecond, true, log.WarnLevel, false},
+		"success is info":              {StructuredOptions{Levels: DefaultStatusLevels}, "/", 200, time.Millisecond, true, log.InfoLevel, false},
+		"excluded path":                {StructuredOptions{Exclude: []string{"/health"}}, "/health", 200, time.Millisecond, false, log.InfoLevel, false},
+		"excluded pattern":             {StructuredOptions{Exclude: []string{"/static/*"}}, "/static/app.js", 200, time.Millisecond, false, log.InfoLevel, false},
+		"not excluded":                 {StructuredOptions{Exclude: []string{"/health"}}, "/healthy", 200, time.Millisecond, true, log.InfoLevel, false},
+		"success not sampled":          {StructuredOptions{SuccessSampleRate: 0.4, random: random}, "/", 200, time.Millisecond, false, log.InfoLevel, false},
+		"success sampled":              {StructuredOptions{SuccessSampleRate: 0.6, random: random}, "/", 200, time.Millisecond, true, log.InfoLevel, false},
+		"errors are never sampled":     {StructuredOptions{SuccessSampleRate: 0.1, random: random}, "/", 400, time.Millisecond, true, log.InfoLevel, false},
+		"slow requests are warnings":   {StructuredOptions{SlowThreshold: time.Second}, "/", 200, 2 * time.Second, true, log.WarnLevel, true},
+		"slow errors stay errors":      {StructuredOptions{Levels: DefaultStatusLevels, SlowThreshold: time.Second}, "/", 500, 2 * time.Second, true, log.ErrorLevel, true},
+		"slow excluded requests":       {StructuredOptions{Exclude: []string{"/health"}, SlowThreshold: time.Second}, "/health", 200, 2 * time.Second, true, log.WarnLevel, true},
+		"slow unsampled requests":      {StructuredOptions{SuccessSampleRate: 0.1, random: random, SlowThreshold: time.Second}, "/", 200, 2 * time.Second, true, log.WarnLevel, true},
+		"fast requests are not marked": {StructuredOptions{SlowThreshold: time.Second}, "/", 200, 500 * time.Millisecond, true, log.InfoLevel, false},
+	}
+
+	logger := log.New("", "", "")
+	hook := test.NewLocal(logger.Logger)
+
+	for k, tc := range cases {
+		hook.Reset()
+		req := newRequest("GET", "http://example.com"+tc.path)
+		responseLogger := &responseLogger{w: httptest.NewRecorder()}
+		writeStructuredLog(responseLogger, logger, tc.options, nil, req, *req.URL, time.Now(), tc.dur, tc.status, 0)
+
+		if !tc.logged {
+			assert.Equal(t, 0, len(hook.Entries), "test: %s", k)
+			continue
+		}
+		assert.Equal(t, 1, len(hook.Entries), "test: %s", k)
+		assert.Equal(t, tc.level, hook.LastEntry().Level, "test: %s", k)
+		if tc.slow {
+			assert.Equal(t, true, hook.LastEntry().Data["http.slow"], "test: %s", k)
+		} else {
+			assert.NotContains(t, hook.LastEntry().Data, "http.slow", "test: %s", k)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/graze/golang-service/log"
+)
+
+const (
+	// TraceParentHeader is the W3C Trace Context header identifying the trace and parent span
+	TraceParentHeader = "Traceparent"
+	// TraceStateHeader is the W3C Trace Context header carrying vendor specific trace information
+	TraceStateHeader = "Tracestate"
+	// maxTraceStateMembers is the maximum number of list members in a tracestate header
+	maxTraceStateMembers = 32
+)
+
+// Trace is the W3C Trace Context of a request
+//
+// see https://www.w3.org/TR/trace-context/
+type Trace struct {
+	// TraceID is the 32 hex character id shared by every span in the trace
+	TraceID string
+	// SpanID is the 16 hex character id of the span handling this request
+	SpanID string
+	// ParentID is the span id of the caller, empty if this request started the trace
+	ParentID string
+	// Flags are the trace flags, 0x01 is sampled
+	Flags byte
+	// State is the tracestate header to pass on
+	State string
+}
+
+// TraceParent returns the traceparent header for requests made by this span
+func (t Trace) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", t.TraceID, t.SpanID, t.Flags)
+}
+
+// Sampled returns true if the caller may have recorded the trace
+func (t Trace) Sampled() bool {
+	return t.Flags&0x01 == 0x01
+}
+
+// ParseTraceParent parses a traceparent header into a Trace with the parent's span id
+//
+//  traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(header string) (Trace, error) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 || (len(header) > 55 && header[55] != '-') {
+		return Trace{}, fmt.Errorf("ParseTraceParent: %q is not a valid traceparent", header)
+	}
+	version, traceID, parentID, flags := header[0:2], header[3:35], header[36:52], header[53:55]
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' ||
+		!lowerHex(version) || version == "ff" || (version == "00" && len(header) != 55) ||
+		!lowerHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		!lowerHex(parentID) || parentID == strings.Repeat("0", 16) ||
+		!lowerHex(flags) {
+		return Trace{}, fmt.Errorf("ParseTraceParent: %q is not a valid traceparent", header)
+	}
+	f, _ := hex.DecodeString(flags)
+	return Trace{TraceID: traceID, ParentID: parentID, Flags: f[0]}, nil
+}
+
+// lowerHex returns true if s only contains lower case hex characters
+func lowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanTraceState removes empty and invalid list members from tracestate headers and limits them to 32 members
+func cleanTraceState(headers []string) string {
+	var members []string
+	for _, header := range headers {
+		for _, member := range strings.Split(header, ",") {
+			member = strings.TrimSpace(member)
+			if i := strings.Index(member, "="); i > 0 && i < len(member)-1 && len(members) < maxTraceStateMembers {
+				members = append(members, member)
+			}
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type traceHandler struct {
+	handler http.Handler
+}
+
+// ServeHTTP continues or starts a trace and stores it in the request context
+func (h traceHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	trace, err := ParseTraceParent(req.Header.Get(TraceParentHeader))
+	if err == nil {
+		trace.State = cleanTraceState(req.Header[TraceStateHeader])
+	} else {
+		trace = Trace{TraceID: randomHex(16)}
+	}
+	trace.SpanID = randomHex(8)
+
+	ctx := context.WithValue(req.Context(), traceKey, trace)
+	ctx = log.Ctx(ctx).With(log.KV{
+		"trace.id":      trace.TraceID,
+		"trace.span":    trace.SpanID,
+		"trace.parent":  trace.ParentID,
+		"trace.sampled": trace.Sampled(),
+	}).NewContext(ctx)
+	h.handler.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// TraceFromContext returns the Trace stored in ctx by TraceHandler
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	trace, ok := ctx.Value(traceKey).(Trace)
+	return trace, ok
+}
+
+// GetTrace returns the Trace of req stored by TraceHandler
+func GetTrace(req *http.Request) (Trace, bool) {
+	return TraceFromContext(req.Context())
+}
+
+// InjectTrace adds the traceparent and tracestate headers for the trace in ctx to an outgoing request
+//
+// The span of ctx becomes the parent of the span handling out. Nothing is added if ctx has no trace
+//
+// Usage:
+//  func GetList(w http.ResponseWriter, r *http.Request) {
+//      out, _ := http.NewRequest("GET", "http://other-service/items", nil)
+//      handlers.InjectTrace(r.Context(), out)
+//      resp, err := http.DefaultClient.Do(out)
+//  }
+func InjectTrace(ctx context.Context, out *http.Request) {
+	trace, ok := TraceFromContext(ctx)
+	if !ok {
+		return
+	}
+	out.Header.Set(TraceParentHeader, trace.TraceParent())
+	if trace.State != "" {
+		out.Header.Set(TraceStateHeader, trace.State)
+	} else {
+		out.Header.Del(TraceStateHeader)
+	}
+}
+
+// TraceHandler returns a handler that continues the W3C Trace Context of a request, or starts a new trace
+//
+// A valid inbound traceparent header is continued with a new span id, otherwise a new trace is started. The trace can
+// be retrieved with GetTrace, passed to outgoing requests with InjectTrace, and is added to the logging context:
+//  trace.id      - 4bf92f3577b34da6a3ce929d0e0e4736
+//  trace.span    - 00f067aa0ba902b7 - the span handling this request
+//  trace.parent  - b7ad6b7169203331 - the span of the caller, empty for a new trace
+//  trace.sampled - true/false
+func TraceHandler(h http.Handler) http.Handler {
+	return traceHandler{h}
+}
@@ -0,0 +1,162 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graze/golang-service/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	cases := map[string]struct {
+		header string
+		trace  Trace
+		err    bool
+	}{
+		"valid": {
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentID: "00f067aa0ba902b7", Flags: 1},
+			false,
+		},
+		"not sampled": {
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentID: "00f067aa0ba902b7"},
+			false,
+		},
+		"future version with more fields": {
+			"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentID: "00f067aa0ba902b7", Flags: 1},
+			false,
+		},
+		"empty":                   {"", Trace{}, true},
+		"upper case":              {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", Trace{}, true},
+		"invalid version":         {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Trace{}, true},
+		"version 00 extra fields": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", Trace{}, true},
+		"zero trace id":           {"00-00000000000000000000000000000000-00f067aa0ba902b7-01", Trace{}, true},
+		"zero parent id":          {"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", Trace{}, true},
+		"short trace id":          {"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", Trace{}, true},
+		"bad separator":           {"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Trace{}, true},
+		"non hex flags":           {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz", Trace{}, true},
+	}
+
+	for k, tc := range cases {
+		trace, err := ParseTraceParent(tc.header)
+		assert.Equal(t, tc.err, err != nil, "test: %s", k)
+		assert.Equal(t, tc.trace, trace, "test: %s", k)
+	}
+}
+
+func TestTraceHandler(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		headers map[string][]string
+		traceID string
+		parent  string
+		state   string
+		sampled bool
+	}{
+		"continues trace": {
+			map[string][]string{
+				TraceParentHeader: {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+				TraceStateHeader:  {"congo=t61rcWkgMzE", "rojo=00f067aa0ba902b7, ,invalid"},
+			},
+			"4bf92f3577b34da6a3ce929d0e0e4736",
+			"00f067aa0ba902b7",
+			"congo=t61rcWkgMzE,rojo=00f067aa0ba902b7",
+			true,
+		},
+		"new trace": {
+			map[string][]string{},
+			"",
+			"",
+			"",
+			false,
+		},
+		"invalid traceparent starts a new trace and drops tracestate": {
+			map[string][]string{
+				TraceParentHeader: {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+				TraceStateHeader:  {"congo=t61rcWkgMzE"},
+			},
+			"",
+			"",
+			"",
+			false,
+		},
+	}
+
+	for k, tc := range cases {
+		var (
+			trace  Trace
+			ok     bool
+			fields log.KV
+		)
+		handler := TraceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace, ok = GetTrace(r)
+			fields = log.Ctx(r.Context()).Fields()
+		}))
+		req := newRequest("GET", "http://example.com")
+		for h, values := range tc.headers {
+			req.Header[h] = values
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.True(t, ok, "test: %s", k)
+		if tc.traceID != "" {
+			assert.Equal(t, tc.traceID, trace.TraceID, "test: %s", k)
+		} else {
+			assert.Regexp(t, "^[0-9a-f]{32}$", trace.TraceID, "test: %s", k)
+		}
+		assert.Regexp(t, "^[0-9a-f]{16}$", trace.SpanID, "test: %s", k)
+		assert.NotEqual(t, tc.parent, trace.SpanID, "test: %s", k)
+		assert.Equal(t, tc.parent, trace.ParentID, "test: %s", k)
+		assert.Equal(t, tc.state, trace.State, "test: %s", k)
+		assert.Equal(t, tc.sampled, trace.Sampled(), "test: %s", k)
+
+		assert.Equal(t, trace.TraceID, fields["trace.id"], "test: %s", k)
+		assert.Equal(t, trace.SpanID, fields["trace.span"], "test: %s", k)
+		assert.Equal(t, trace.ParentID, fields["trace.parent"], "test: %s", k)
+		assert.Equal(t, trace.Sampled(), fields["trace.sampled"], "test: %s", k)
+	}
+}
+
+func TestTraceStateIsLimitedTo32Members(t *testing.T) {
+	members := make([]string, 40)
+	for i := range members {
+		members[i] = "k=v"
+	}
+	assert.Equal(t, 32, len(strings.Split(cleanTraceState([]string{strings.Join(members, ",")}), ",")))
+}
+
+func TestInjectTrace(t *testing.T) {
+	out := newRequest("GET", "http://other.example.com")
+	InjectTrace(context.Background(), out)
+	assert.Equal(t, "", out.Header.Get(TraceParentHeader), "no trace in the context")
+
+	var ctx context.Context
+	req := newRequest("GET", "http://example.com")
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TraceStateHeader, "congo=t61rcWkgMzE")
+	TraceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	trace, _ := TraceFromContext(ctx)
+	InjectTrace(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+trace.SpanID+"-01", out.Header.Get(TraceParentHeader))
+	assert.Equal(t, "congo=t61rcWkgMzE", out.Header.Get(TraceStateHeader))
+}
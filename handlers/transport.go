@@ -0,0 +1,171 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	"github.com/graze/golang-service/log"
+	"github.com/graze/golang-service/metrics"
+)
+
+// Transport is a http.RoundTripper that logs and times outbound requests
+//
+// The request id (see RequestIDHandler) and trace (see TraceHandler) of the request context are passed on to the
+// requested service.
+type Transport struct {
+	// Base makes the requests. Defaults to http.DefaultTransport
+	Base http.RoundTripper
+	// Logger is used with the request context to log each request. Defaults to the global logger
+	Logger log.FieldLogger
+	// Statsd gets the duration and a count of each request, if set
+	Statsd metrics.Client
+}
+
+// RoundTrip sends req using the Base transport, logging the response
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := propagate(req)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ts := time.Now().UTC()
+	mt := monotime.Now()
+	resp, err := base.RoundTrip(out)
+	dur := time.Duration(monotime.Now() - mt)
+
+	status, size, proto := 0, int64(0), out.Proto
+	if resp != nil {
+		status, size, proto = resp.StatusCode, resp.ContentLength, resp.Proto
+	}
+
+	if t.Statsd != nil {
+		statusTag := "statusCode:" + strconv.Itoa(status)
+		if err != nil {
+			statusTag = "statusCode:error"
+		}
+		tags := []string{
+			"host:" + out.URL.Host,
+			statusTag,
+			"method:" + out.Method,
+		}
+		t.Statsd.Timing("client.response_time", dur, tags, 1)
+		t.Statsd.Incr("client.count", tags, 1)
+	}
+
+	logger := t.Logger
+	if logger == nil {
+		logger = log.With(log.KV{})
+	}
+	// credentials and sensitive query parameters in the url are never logged
+	u := redactURL(out.URL)
+	fields := log.KV{
+		"tag":           "request_sent",
+		"http.method":   out.Method,
+		"http.protocol": proto,
+		"http.uri":      u.RequestURI(),
+		"http.path":     out.URL.EscapedPath(),
+		"http.host":     out.URL.Host,
+		"http.status":   status,
+		"dur":           dur.Seconds(),
+		"http.time":     ts.Format(time.RFC3339Nano),
+	}
+	// the length of chunked responses is not known (-1)
+	if size >= 0 {
+		fields["http.bytes"] = size
+	}
+	entry := logger.Ctx(out.Context()).With(fields)
+
+	if err != nil {
+		entry.Err(err).Warnf("%s %s failed", out.Method, u.String())
+	} else {
+		entry.Infof("%s %s %s", out.Method, u.String(), proto)
+	}
+
+	return resp, err
+}
+
+// redactURL returns a copy of u without the user info and with the values of query parameters whose names contain any
+// of log.RedactedFields replaced by log.RedactMask
+func redactURL(u *url.URL) *url.URL {
+	out := *u
+	out.User = nil
+	if out.RawQuery == "" {
+		return &out
+	}
+
+	params := strings.Split(out.RawQuery, "&")
+	for i, param := range params {
+		key := strings.SplitN(param, "=", 2)[0]
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if sensitiveParam(name) {
+			params[i] = key + "=" + log.RedactMask
+		}
+	}
+	out.RawQuery = strings.Join(params, "&")
+	return &out
+}
+
+// sensitiveParam returns true if the query parameter name contains any of log.RedactedFields, ignoring case
+func sensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range log.RedactedFields {
+		if strings.Contains(name, strings.ToLower(field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// propagate returns a copy of req with the request id and trace of its context added to the headers
+//
+// A http.RoundTripper must not modify the request it is given, so the headers are copied
+func propagate(req *http.Request) *http.Request {
+	out := new(http.Request)
+	*out = *req
+	out.Header = make(http.Header, len(req.Header)+2)
+	for k, v := range req.Header {
+		out.Header[k] = append([]string(nil), v...)
+	}
+
+	if id := RequestIDFromContext(req.Context()); id != "" && out.Header.Get(RequestIDHeader) == "" {
+		out.Header.Set(RequestIDHeader, id)
+	}
+	InjectTrace(req.Context(), out)
+	return out
+}
+
+// NewTransport creates a Transport wrapping base that logs to logger and sends metrics to client
+//
+// Any of the arguments can be nil
+//
+// Usage:
+//  client := &http.Client{
+//      Transport: handlers.NewTransport(nil, log.With(log.KV{"module": "request.client"}), statsdClient),
+//  }
+//
+//  func GetList(w http.ResponseWriter, r *http.Request) {
+//      out, _ := http.NewRequest("GET", "http://other-service/items", nil)
+//      resp, err := client.Do(out.WithContext(r.Context()))
+//  }
+func NewTransport(base http.RoundTripper, logger log.FieldLogger, client metrics.Client) *Transport {
+	return &Transport{base, logger, client}
+}
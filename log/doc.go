@@ -96,5 +96,12 @@ You can use a logging context stored within a `context.Context` with a second lo
 
 As the logger is based on logrus you can add Hooks to each logger to send data to multiple outputs.
 See: https://github.com/Sirupsen/logrus#hooks
+
+A RedactFormatter masks sensitive fields (authorization, password, token, ...) before they are formatted
+
+    log.SetFormatter(log.NewRedactFormatter(&logrus.TextFormatter{}))
+    log.With(log.KV{"http.authorization": "Graze some-key"}).Info("text")
+
+    // http.authorization="[REDACTED]" level=info msg=text
 */
 package log
@@ -0,0 +1,86 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package log
+
+import (
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// RedactedFields are the field names masked by NewRedactFormatter when no fields are supplied
+var RedactedFields = []string{"authorization", "password", "token", "secret", "api-key", "api_key", "apikey", "cookie"}
+
+// RedactMask is the value that replaces a redacted field
+const RedactMask = "[REDACTED]"
+
+// RedactFormatter is a logrus.Formatter that masks the values of sensitive fields before formatting the entry with
+// another Formatter
+//
+// A field is masked if its name contains any of Fields, ignoring case. So `password` matches `user.password` and
+// `token` matches `http.access_token`
+type RedactFormatter struct {
+	// Formatter formats the masked entry. Defaults to a logrus.TextFormatter
+	Formatter logrus.Formatter
+	Fields    []string
+	Mask      string
+}
+
+// NewRedactFormatter creates a RedactFormatter wrapping formatter that masks fields containing any of fields, or
+// RedactedFields if none are supplied
+//
+// Usage:
+//  log.SetFormatter(log.NewRedactFormatter(&logrus.TextFormatter{}))
+//  log.With(log.KV{"http.authorization": "Graze some-key"}).Info("request")
+//
+//  // http.authorization="[REDACTED]" level=info msg=request
+func NewRedactFormatter(formatter logrus.Formatter, fields ...string) *RedactFormatter {
+	if len(fields) == 0 {
+		fields = RedactedFields
+	}
+	lower := make([]string, len(fields))
+	for i, f := range fields {
+		lower[i] = strings.ToLower(f)
+	}
+	return &RedactFormatter{formatter, lower, RedactMask}
+}
+
+// Format replaces the value of any sensitive fields of entry with the Mask and formats it with the Formatter
+//
+// The fields are masked in a copy of the entry, so the Data of the entry and the logger it came from are not modified
+func (f *RedactFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	formatter := f.Formatter
+	if formatter == nil {
+		formatter = &logrus.TextFormatter{}
+	}
+
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		if f.matches(k) {
+			v = f.Mask
+		}
+		data[k] = v
+	}
+	masked := *entry
+	masked.Data = data
+	return formatter.Format(&masked)
+}
+
+// matches returns true if the field name contains any of the redacted fields
+func (f *RedactFormatter) matches(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range f.Fields {
+		if strings.Contains(name, strings.ToLower(field)) {
+			return true
+		}
+	}
+	return false
+}
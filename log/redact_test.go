@@ -0,0 +1,91 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactFormatter(t *testing.T) {
+	cases := map[string]struct {
+		redact   func(formatter logrus.Formatter) *RedactFormatter
+		fields   KV
+		expected KV
+	}{
+		"default fields": {
+			func(formatter logrus.Formatter) *RedactFormatter { return NewRedactFormatter(formatter) },
+			KV{"authorization": "Graze key", "password": "pass", "token": "abc", "path": "/"},
+			KV{"authorization": RedactMask, "password": RedactMask, "token": RedactMask, "path": "/"},
+		},
+		"namespaced and mixed case": {
+			func(formatter logrus.Formatter) *RedactFormatter { return NewRedactFormatter(formatter) },
+			KV{"http.Authorization": "Graze key", "user.password": "pass", "access_token": 1},
+			KV{"http.Authorization": RedactMask, "user.password": RedactMask, "access_token": RedactMask},
+		},
+		"custom fields": {
+			func(formatter logrus.Formatter) *RedactFormatter { return NewRedactFormatter(formatter, "email") },
+			KV{"user.email": "me@example.com", "password": "pass"},
+			KV{"user.email": RedactMask, "password": "pass"},
+		},
+	}
+
+	for k, tc := range cases {
+		buf := &bytes.Buffer{}
+		logger := New("", "", "")
+		logger.SetOutput(buf)
+		logger.SetFormatter(tc.redact(&logrus.JSONFormatter{}))
+
+		logger.With(tc.fields).Info("text")
+
+		for field, value := range tc.expected {
+			if value == RedactMask {
+				assert.Contains(t, buf.String(), `"`+field+`":"`+RedactMask+`"`, "test: %s", k)
+			} else {
+				assert.Contains(t, buf.String(), `"`+field+`":"`+value.(string)+`"`, "test: %s", k)
+			}
+		}
+		assert.NotContains(t, buf.String(), "Graze key", "test: %s", k)
+	}
+}
+
+func TestRedactFormatterDoesNotModifyTheLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New("", "", "")
+	logger.SetOutput(buf)
+	logger.SetFormatter(NewRedactFormatter(nil))
+
+	entry := logger.With(KV{"password": "pass", "path": "/"})
+	entry.Info("first")
+	entry.Info("second")
+
+	assert.Equal(t, "pass", entry.Fields()["password"], "the fields of the logger are not masked")
+	assert.NotContains(t, buf.String(), "pass\"")
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte(RedactMask)))
+}
+
+func TestRedactFormatterWithHooks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New("", "", "")
+	logger.SetOutput(buf)
+	logger.SetFormatter(NewRedactFormatter(&logrus.JSONFormatter{}))
+	hook := test.NewLocal(logger.Logger)
+
+	logger.With(KV{"http.authorization": "Graze some-key"}).Error("text")
+
+	assert.Contains(t, buf.String(), `"http.authorization":"`+RedactMask+`"`)
+	assert.NotContains(t, buf.String(), "some-key")
+	assert.Equal(t, "Graze some-key", hook.LastEntry().Data["http.authorization"], "hooks get the fields unmasked")
+}
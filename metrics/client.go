@@ -0,0 +1,93 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// Client sends metrics to a metrics backend
+//
+// Each metric takes a list of tags in the form `name:value` and a sample rate between 0 and 1
+type Client interface {
+	// Count adds value to a counter
+	Count(name string, value int64, tags []string, rate float64) error
+	// Incr adds 1 to a counter
+	Incr(name string, tags []string, rate float64) error
+	// Gauge records the current value of a metric
+	Gauge(name string, value float64, tags []string, rate float64) error
+	// Timing records a duration
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+	// Histogram records a value in a statistical distribution
+	Histogram(name string, value float64, tags []string, rate float64) error
+}
+
+// the DataDog client returned by GetStatsd can be used as a Client directly
+var _ Client = (*statsd.Client)(nil)
+
+// DataDog is a Client that sends metrics using a DataDog statsd client. A nil statsd client sends nothing
+type DataDog struct {
+	Client *statsd.Client
+}
+
+// Count adds value to a counter
+func (d DataDog) Count(name string, value int64, tags []string, rate float64) error {
+	return d.Client.Count(name, value, tags, rate)
+}
+
+// Incr adds 1 to a counter
+func (d DataDog) Incr(name string, tags []string, rate float64) error {
+	return d.Client.Incr(name, tags, rate)
+}
+
+// Gauge records the current value of a metric
+func (d DataDog) Gauge(name string, value float64, tags []string, rate float64) error {
+	return d.Client.Gauge(name, value, tags, rate)
+}
+
+// Timing records a duration
+func (d DataDog) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	return d.Client.Timing(name, value, tags, rate)
+}
+
+// Histogram records a value in a statistical distribution
+func (d DataDog) Histogram(name string, value float64, tags []string, rate float64) error {
+	return d.Client.Histogram(name, value, tags, rate)
+}
+
+// NewDataDog creates a Client sending metrics to a DataDog statsd client
+//
+// Usage:
+//  c, _ := statsd.New("127.0.0.1:8125")
+//  client := metrics.NewDataDog(c)
+func NewDataDog(c *statsd.Client) Client {
+	return DataDog{c}
+}
+
+// Noop is a Client that discards every metric
+type Noop struct{}
+
+// Count does nothing
+func (Noop) Count(name string, value int64, tags []string, rate float64) error { return nil }
+
+// Incr does nothing
+func (Noop) Incr(name string, tags []string, rate float64) error { return nil }
+
+// Gauge does nothing
+func (Noop) Gauge(name string, value float64, tags []string, rate float64) error { return nil }
+
+// Timing does nothing
+func (Noop) Timing(name string, value time.Duration, tags []string, rate float64) error { return nil }
+
+// Histogram does nothing
+func (Noop) Histogram(name string, value float64, tags []string, rate float64) error { return nil }
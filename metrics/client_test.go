@@ -0,0 +1,90 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package metrics
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/graze/golang-service/nettest"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendAll(client Client) {
+	client.Count("count", 3, []string{"tag"}, 1)
+	client.Incr("incr", []string{"tag"}, 1)
+	client.Gauge("gauge", 2.5, []string{"tag"}, 1)
+	client.Timing("timing", 1500*time.Millisecond, []string{"tag"}, 1)
+	client.Histogram("histogram", 4, []string{"tag"}, 1)
+}
+
+func TestDataDog(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWg := nettest.CreateServer(t, "udp", "localhost:", done)
+	defer srvWg.Wait()
+	defer os.Remove(addr.String())
+	defer sock.Close()
+
+	c, err := statsd.New(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendAll(NewDataDog(c))
+
+	for _, expected := range []string{
+		"count:3|c|#tag",
+		"incr:1|c|#tag",
+		"gauge:2.500000|g|#tag",
+		"timing:1500.000000|ms|#tag",
+		"histogram:4.000000|h|#tag",
+	} {
+		assert.Equal(t, expected, <-done)
+	}
+}
+
+func TestNilDataDogAndNoop(t *testing.T) {
+	cases := map[string]struct {
+		client Client
+	}{
+		"nil datadog": {NewDataDog(nil)},
+		"noop":        {Noop{}},
+	}
+
+	for k, tc := range cases {
+		assert.NoError(t, tc.client.Count("count", 1, nil, 1), "test: %s", k)
+		assert.NoError(t, tc.client.Incr("incr", nil, 1), "test: %s", k)
+		assert.NoError(t, tc.client.Gauge("gauge", 1, nil, 1), "test: %s", k)
+		assert.NoError(t, tc.client.Timing("timing", time.Second, nil, 1), "test: %s", k)
+		assert.NoError(t, tc.client.Histogram("histogram", 1, nil, 1), "test: %s", k)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+	sendAll(recorder)
+
+	assert.Equal(t, []Metric{
+		{CountType, "count", 3, []string{"tag"}, 1},
+		{CountType, "incr", 1, []string{"tag"}, 1},
+		{GaugeType, "gauge", 2.5, []string{"tag"}, 1},
+		{TimingType, "timing", 1500, []string{"tag"}, 1},
+		{HistogramType, "histogram", 4, []string{"tag"}, 1},
+	}, recorder.Metrics())
+
+	assert.Equal(t, []Metric{{GaugeType, "gauge", 2.5, []string{"tag"}, 1}}, recorder.Find("gauge"))
+	assert.Empty(t, recorder.Find("unknown"))
+
+	recorder.Reset()
+	assert.Empty(t, recorder.Metrics())
+}
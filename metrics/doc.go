@@ -30,5 +30,30 @@ Example:
 Usage:
     client, _ := GetStatsdFromEnv()
     client.Incr("metric", []string{"tag","tag2"}, 1)
+
+LoadStatsdConf also reads the DD_AGENT_HOST and DD_DOGSTATSD_PORT fallbacks and the DD_ENV, DD_SERVICE and DD_VERSION
+tags, and returns a *ConfError for invalid values. LoadClientOptions reads STATSD_BUFFER and STATSD_DISABLED into
+ClientOptions. NewClientFromEnv reads both and returns a Noop client when STATSD_DISABLED is set
+
+    client, err := metrics.NewClientFromEnv()
+
+Client
+
+The Client interface sends counts, gauges, timings and histograms. A DataDog *statsd.Client can be used directly or
+through NewDataDog, Noop discards every metric and a Recorder keeps every metric in memory for tests
+
+Usage:
+    recorder := metrics.NewRecorder()
+    handler := handlers.StatsdIoHandler(recorder, r)
+    counts := recorder.Find("request.count")
+
+Runtime
+
+Send goroutine, memory, GC pause and process metrics every interval until stopped or the context is cancelled
+
+Usage:
+    collector := metrics.NewRuntimeCollector(client, 10*time.Second, "service:api")
+    collector.Start(ctx)
+    defer collector.Stop()
 */
 package metrics
@@ -0,0 +1,110 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// The types of a recorded Metric, using the statsd type suffixes
+const (
+	CountType     = "c"
+	GaugeType     = "g"
+	TimingType    = "ms"
+	HistogramType = "h"
+)
+
+// Metric is a single metric sent to a Recorder
+type Metric struct {
+	// Type is one of CountType, GaugeType, TimingType or HistogramType
+	Type string
+	Name string
+	// Value is the value of the metric, timings are in milliseconds
+	Value float64
+	Tags  []string
+	Rate  float64
+}
+
+// Recorder is a Client that keeps every metric in memory, for use in tests
+//
+// Usage:
+//  client := metrics.NewRecorder()
+//  handler := handlers.StatsdIoHandler(client, r)
+//  handler.ServeHTTP(w, req)
+//  counts := client.Find("request.count")
+type Recorder struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+// record stores a metric
+func (r *Recorder) record(kind, name string, value float64, tags []string, rate float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, Metric{kind, name, value, append([]string(nil), tags...), rate})
+	return nil
+}
+
+// Count records a CountType metric
+func (r *Recorder) Count(name string, value int64, tags []string, rate float64) error {
+	return r.record(CountType, name, float64(value), tags, rate)
+}
+
+// Incr records a CountType metric with a value of 1
+func (r *Recorder) Incr(name string, tags []string, rate float64) error {
+	return r.record(CountType, name, 1, tags, rate)
+}
+
+// Gauge records a GaugeType metric
+func (r *Recorder) Gauge(name string, value float64, tags []string, rate float64) error {
+	return r.record(GaugeType, name, value, tags, rate)
+}
+
+// Timing records a TimingType metric in milliseconds
+func (r *Recorder) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	return r.record(TimingType, name, value.Seconds()*1000, tags, rate)
+}
+
+// Histogram records a HistogramType metric
+func (r *Recorder) Histogram(name string, value float64, tags []string, rate float64) error {
+	return r.record(HistogramType, name, value, tags, rate)
+}
+
+// Metrics returns every metric recorded in the order they were sent
+func (r *Recorder) Metrics() []Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Metric(nil), r.metrics...)
+}
+
+// Find returns the recorded metrics called name
+func (r *Recorder) Find(name string) []Metric {
+	var found []Metric
+	for _, m := range r.Metrics() {
+		if m.Name == name {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// Reset removes every recorded metric
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = nil
+}
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
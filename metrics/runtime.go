@@ -0,0 +1,237 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package metrics
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRuntimeInterval is how often a RuntimeCollector sends metrics if no interval is given
+const DefaultRuntimeInterval = 10 * time.Second
+
+// processStart is when the package was initialised, which is used as the start of the process
+var processStart = time.Now()
+
+// RuntimeCollector periodically sends Go runtime and process metrics to a Client
+//
+// The metrics sent are (prefixed with Prefix):
+//  goroutines          - gauge
+//  mem.alloc           - gauge, bytes allocated and in use
+//  mem.sys             - gauge, bytes obtained from the system
+//  mem.heap_alloc      - gauge
+//  mem.heap_sys        - gauge
+//  mem.heap_idle       - gauge
+//  mem.heap_inuse      - gauge
+//  mem.heap_objects    - gauge
+//  mem.mallocs         - count since the last collection
+//  mem.frees           - count since the last collection
+//  gc.count            - count since the last collection
+//  gc.pause_total      - gauge, total milliseconds paused for GC since the process started
+//  gc.pause.p50        - gauge, milliseconds, of the pauses since the last collection
+//  gc.pause.p95        - gauge
+//  gc.pause.p99        - gauge
+//  gc.pause.max        - gauge
+//  process.open_fds    - gauge, only where /proc/self/fd is available
+//  process.uptime      - gauge, seconds since the process started
+type RuntimeCollector struct {
+	// Client receives the metrics
+	Client Client
+	// Interval is the time between collections. Defaults to DefaultRuntimeInterval
+	Interval time.Duration
+	// Prefix is added to each metric name. Defaults to runtime.
+	Prefix string
+	// Tags are added to every metric
+	Tags []string
+
+	mu          sync.Mutex
+	lastNumGC   uint32
+	lastMallocs uint64
+	lastFrees   uint64
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// Start sends metrics every Interval until Stop is called or ctx is cancelled. Calling Start on a running collector
+// does nothing
+//
+// Usage:
+//  collector := metrics.NewRuntimeCollector(client, 10*time.Second, "service:api")
+//  collector.Start(context.Background())
+//  defer collector.Stop()
+func (c *RuntimeCollector) Start(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return
+	}
+
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultRuntimeInterval
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.Collect()
+			}
+		}
+	}(c.done)
+}
+
+// Stop stops sending metrics and waits for the collector to finish
+func (c *RuntimeCollector) Stop() {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel, c.done = nil, nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Collect sends the metrics once
+func (c *RuntimeCollector) Collect() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	c.mu.Lock()
+	pauses := newPauses(&stats, c.lastNumGC)
+	gcs := stats.NumGC - c.lastNumGC
+	mallocs, frees := stats.Mallocs-c.lastMallocs, stats.Frees-c.lastFrees
+	c.lastNumGC, c.lastMallocs, c.lastFrees = stats.NumGC, stats.Mallocs, stats.Frees
+	c.mu.Unlock()
+
+	c.gauge("goroutines", float64(runtime.NumGoroutine()))
+	c.gauge("mem.alloc", float64(stats.Alloc))
+	c.gauge("mem.sys", float64(stats.Sys))
+	c.gauge("mem.heap_alloc", float64(stats.HeapAlloc))
+	c.gauge("mem.heap_sys", float64(stats.HeapSys))
+	c.gauge("mem.heap_idle", float64(stats.HeapIdle))
+	c.gauge("mem.heap_inuse", float64(stats.HeapInuse))
+	c.gauge("mem.heap_objects", float64(stats.HeapObjects))
+	c.count("mem.mallocs", int64(mallocs))
+	c.count("mem.frees", int64(frees))
+	c.count("gc.count", int64(gcs))
+	c.gauge("gc.pause_total", milliseconds(stats.PauseTotalNs))
+	if len(pauses) > 0 {
+		c.gauge("gc.pause.p50", milliseconds(quantile(pauses, 0.5)))
+		c.gauge("gc.pause.p95", milliseconds(quantile(pauses, 0.95)))
+		c.gauge("gc.pause.p99", milliseconds(quantile(pauses, 0.99)))
+		c.gauge("gc.pause.max", milliseconds(pauses[len(pauses)-1]))
+	}
+	if fds, err := openFileDescriptors(); err == nil {
+		c.gauge("process.open_fds", float64(fds))
+	}
+	c.gauge("process.uptime", time.Since(processStart).Seconds())
+}
+
+// gauge sends a gauge with the prefix and tags
+func (c *RuntimeCollector) gauge(name string, value float64) {
+	c.Client.Gauge(c.name(name), value, c.Tags, 1)
+}
+
+// count sends a count with the prefix and tags
+func (c *RuntimeCollector) count(name string, value int64) {
+	c.Client.Count(c.name(name), value, c.Tags, 1)
+}
+
+// name returns the metric name with the prefix
+func (c *RuntimeCollector) name(metric string) string {
+	if c.Prefix == "" {
+		return "runtime." + metric
+	}
+	return c.Prefix + metric
+}
+
+// newPauses returns the sorted GC pauses in nanoseconds since the lastNumGC garbage collection
+//
+// The runtime only keeps the last 256 pauses, so older pauses are lost if there were more collections than that
+func newPauses(stats *runtime.MemStats, lastNumGC uint32) []uint64 {
+	n := stats.NumGC - lastNumGC
+	if n > uint32(len(stats.PauseNs)) {
+		n = uint32(len(stats.PauseNs))
+	}
+	pauses := make([]uint64, 0, n)
+	for i := stats.NumGC - n + 1; i <= stats.NumGC && n > 0; i++ {
+		pauses = append(pauses, stats.PauseNs[(i+uint32(len(stats.PauseNs))-1)%uint32(len(stats.PauseNs))])
+	}
+	sort.Sort(uint64s(pauses))
+	return pauses
+}
+
+// quantile returns the q quantile of the sorted values
+func quantile(sorted []uint64, q float64) uint64 {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// milliseconds converts nanoseconds to milliseconds
+func milliseconds(ns uint64) float64 {
+	return float64(ns) / float64(time.Millisecond)
+}
+
+// openFileDescriptors returns the number of file descriptors open by this process
+func openFileDescriptors() (int, error) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	// the directory being read is one of the open file descriptors
+	return len(names) - 1, nil
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+
+// NewRuntimeCollector creates a RuntimeCollector sending metrics to client every interval with tags
+//
+// The first collection only reports the garbage collections and allocations since the collector was created
+func NewRuntimeCollector(client Client, interval time.Duration, tags ...string) *RuntimeCollector {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return &RuntimeCollector{
+		Client:      client,
+		Interval:    interval,
+		Tags:        tags,
+		lastNumGC:   stats.NumGC,
+		lastMallocs: stats.Mallocs,
+		lastFrees:   stats.Frees,
+	}
+}
@@ -0,0 +1,118 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package metrics
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeCollectorCollect(t *testing.T) {
+	recorder := NewRecorder()
+	collector := NewRuntimeCollector(recorder, time.Second, "service:test")
+	runtime.GC()
+	runtime.GC()
+	collector.Collect()
+
+	cases := map[string]struct {
+		kind string
+	}{
+		"runtime.goroutines":       {GaugeType},
+		"runtime.mem.alloc":        {GaugeType},
+		"runtime.mem.heap_objects": {GaugeType},
+		"runtime.mem.mallocs":      {CountType},
+		"runtime.gc.count":         {CountType},
+		"runtime.gc.pause_total":   {GaugeType},
+		"runtime.gc.pause.p50":     {GaugeType},
+		"runtime.gc.pause.max":     {GaugeType},
+		"runtime.process.uptime":   {GaugeType},
+	}
+
+	for k, tc := range cases {
+		found := recorder.Find(k)
+		if assert.Len(t, found, 1, "test: %s", k) {
+			assert.Equal(t, tc.kind, found[0].Type, "test: %s", k)
+			assert.Equal(t, []string{"service:test"}, found[0].Tags, "test: %s", k)
+		}
+	}
+	assert.True(t, recorder.Find("runtime.gc.count")[0].Value >= 2)
+	assert.True(t, recorder.Find("runtime.goroutines")[0].Value >= 1)
+
+	recorder.Reset()
+	collector.Prefix = "app.runtime."
+	collector.Collect()
+	assert.Len(t, recorder.Find("app.runtime.goroutines"), 1)
+	assert.Empty(t, recorder.Find("app.runtime.gc.pause.p50"), "no pauses since the last collection")
+}
+
+func TestQuantile(t *testing.T) {
+	values := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	cases := map[string]struct {
+		q        float64
+		expected uint64
+	}{
+		"p50": {0.5, 5},
+		"p95": {0.95, 10},
+		"p0":  {0, 1},
+		"p1":  {1, 10},
+	}
+
+	for k, tc := range cases {
+		assert.Equal(t, tc.expected, quantile(values, tc.q), "test: %s", k)
+	}
+}
+
+func TestNewPauses(t *testing.T) {
+	stats := &runtime.MemStats{NumGC: 258}
+	for i := range stats.PauseNs {
+		stats.PauseNs[i] = uint64(i)
+	}
+
+	assert.Equal(t, []uint64{0, 1}, newPauses(stats, 256), "gc 257 and 258 wrap around the buffer")
+	assert.Len(t, newPauses(stats, 0), 256, "limited to the pauses kept by the runtime")
+	assert.Empty(t, newPauses(stats, 258))
+}
+
+func TestRuntimeCollectorStartStop(t *testing.T) {
+	recorder := NewRecorder()
+	collector := NewRuntimeCollector(recorder, time.Millisecond)
+
+	collector.Start(context.Background())
+	collector.Start(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	collector.Stop()
+
+	sent := len(recorder.Find("runtime.goroutines"))
+	assert.True(t, sent > 0)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, sent, len(recorder.Find("runtime.goroutines")), "nothing is sent after stopping")
+	collector.Stop()
+}
+
+func TestRuntimeCollectorContext(t *testing.T) {
+	recorder := NewRecorder()
+	collector := NewRuntimeCollector(recorder, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collector.Start(ctx)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	time.Sleep(5 * time.Millisecond)
+
+	sent := len(recorder.Find("runtime.goroutines"))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, sent, len(recorder.Find("runtime.goroutines")), "nothing is sent after the context is cancelled")
+	collector.Stop()
+}
@@ -10,7 +10,17 @@
 
 package metrics
 
-import "github.com/DataDog/datadog-go/statsd"
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// DefaultStatsdPort is the port used if none is configured
+const DefaultStatsdPort = "8125"
 
 // StatsdClientConf is a configuration struct to create a StatsD client
 type StatsdClientConf struct {
@@ -18,9 +28,76 @@ type StatsdClientConf struct {
 	Tags                  []string
 }
 
+// ClientOptions are the optional settings of a statsd client created by NewClientWith or GetStatsdWith
+type ClientOptions struct {
+	// Buffer is the number of metrics to buffer before sending them together. 0 sends each metric as it is recorded
+	Buffer int
+	// Disabled creates a client that sends nothing
+	Disabled bool
+}
+
+// ConfError is returned when a StatsdClientConf or the environment variables it is read from are not valid
+type ConfError struct {
+	// Field is the name of the configuration field or environment variable
+	Field string
+	// Value is the invalid value
+	Value string
+	// Reason describes what is wrong with the value
+	Reason string
+}
+
+func (e *ConfError) Error() string {
+	return fmt.Sprintf("statsd configuration %s: '%s' is not valid: %s", e.Field, e.Value, e.Reason)
+}
+
+// Validate returns a *ConfError if the configuration can not be used to create a client
+func (conf StatsdClientConf) Validate() error {
+	if conf.Host == "" {
+		return &ConfError{"Host", conf.Host, "a host is required"}
+	}
+	if port, err := strconv.Atoi(conf.Port); err != nil || port < 1 || port > 65535 {
+		return &ConfError{"Port", conf.Port, "expecting a port number between 1 and 65535"}
+	}
+	for _, tag := range conf.Tags {
+		if tag == "" || strings.ContainsAny(tag, ",|") {
+			return &ConfError{"Tags", tag, "tags must not be empty or contain commas or pipes"}
+		}
+	}
+	return nil
+}
+
+// Validate returns a *ConfError if the options can not be used to create a client
+func (options ClientOptions) Validate() error {
+	if options.Buffer < 0 {
+		return &ConfError{"Buffer", strconv.Itoa(options.Buffer), "must not be negative"}
+	}
+	return nil
+}
+
 // GetStatsd returns a statsd client based on the supplied StatsdClientConf
-func GetStatsd(conf StatsdClientConf) (client *statsd.Client, err error) {
-	client, err = statsd.New(conf.Host + ":" + conf.Port)
+//
+// A *ConfError is returned if conf is not valid
+func GetStatsd(conf StatsdClientConf) (*statsd.Client, error) {
+	return GetStatsdWith(conf, ClientOptions{})
+}
+
+// GetStatsdWith returns a statsd client based on the supplied StatsdClientConf and ClientOptions
+//
+// A *ConfError is returned if conf or options are not valid. If options is disabled the client is nil, which sends
+// nothing
+func GetStatsdWith(conf StatsdClientConf, options ClientOptions) (client *statsd.Client, err error) {
+	if err = options.Validate(); err != nil || options.Disabled {
+		return nil, err
+	}
+	if err = conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	if options.Buffer > 0 {
+		client, err = statsd.NewBuffered(conf.Host+":"+conf.Port, options.Buffer)
+	} else {
+		client, err = statsd.New(conf.Host + ":" + conf.Port)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -29,3 +106,155 @@ func GetStatsd(conf StatsdClientConf) (client *statsd.Client, err error) {
 	client.Tags = append(client.Tags, conf.Tags...)
 	return
 }
+
+// NewClient returns a Client based on the supplied StatsdClientConf
+//
+// A *ConfError is returned if conf is not valid
+func NewClient(conf StatsdClientConf) (Client, error) {
+	return NewClientWith(conf, ClientOptions{})
+}
+
+// NewClientWith returns a Client based on the supplied StatsdClientConf and ClientOptions
+//
+// A *ConfError is returned if conf or options are not valid. If options is disabled a Noop client is returned
+//
+// Usage:
+//  client, err := metrics.NewClientWith(conf, metrics.ClientOptions{Buffer: 50})
+func NewClientWith(conf StatsdClientConf, options ClientOptions) (Client, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if options.Disabled {
+		return Noop{}, nil
+	}
+	client, err := GetStatsdWith(conf, options)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClientFromEnv returns a Client configured by environment variables (see LoadStatsdConf and LoadClientOptions)
+//
+// Usage:
+//  client, err := metrics.NewClientFromEnv()
+//  if err != nil {
+//      log.Err(err).Fatal("invalid statsd configuration")
+//  }
+func NewClientFromEnv() (Client, error) {
+	options, err := LoadClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	if options.Disabled {
+		return NewClientWith(StatsdClientConf{}, options)
+	}
+	conf, err := LoadStatsdConf()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWith(conf, options)
+}
+
+// GetStatsdFromEnv returns a statsd client using the STATSD_* environment variables (see LoadStatsdConf and
+// LoadClientOptions)
+func GetStatsdFromEnv() (*statsd.Client, error) {
+	options, err := LoadClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	if options.Disabled {
+		return GetStatsdWith(StatsdClientConf{}, options)
+	}
+	conf, err := LoadStatsdConf()
+	if err != nil {
+		return nil, err
+	}
+	return GetStatsdWith(conf, options)
+}
+
+// StatsdConfFromEnv creates a StatsdClientConf from the STATSD_* environment variables
+//
+// Invalid values are ignored, use LoadStatsdConf to get an error for them
+func StatsdConfFromEnv() StatsdClientConf {
+	conf, _ := LoadStatsdConf()
+	return conf
+}
+
+// LoadStatsdConf creates a StatsdClientConf from environment variables and validates it
+//
+// Environment Variables:
+//  STATSD_HOST: the host of the statsd server, defaults to DD_AGENT_HOST
+//  STATSD_PORT: the port of the statsd server, defaults to DD_DOGSTATSD_PORT or 8125
+//  STATSD_NAMESPACE: the namespace to prefix to every metric name
+//  STATSD_TAGS: a comma separated list of tags to apply to every metric reported
+//  DD_ENV, DD_SERVICE, DD_VERSION: added as the env, service and version tags
+//
+// A *ConfError is returned for the first invalid value
+func LoadStatsdConf() (StatsdClientConf, error) {
+	conf := StatsdClientConf{
+		Host:      firstEnv("STATSD_HOST", "DD_AGENT_HOST"),
+		Port:      firstEnv("STATSD_PORT", "DD_DOGSTATSD_PORT"),
+		Namespace: os.Getenv("STATSD_NAMESPACE"),
+	}
+	if conf.Port == "" {
+		conf.Port = DefaultStatsdPort
+	}
+	if tags := os.Getenv("STATSD_TAGS"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				conf.Tags = append(conf.Tags, tag)
+			}
+		}
+	}
+	for _, tag := range []struct{ name, env string }{{"env", "DD_ENV"}, {"service", "DD_SERVICE"}, {"version", "DD_VERSION"}} {
+		if value := os.Getenv(tag.env); value != "" {
+			conf.Tags = append(conf.Tags, tag.name+":"+value)
+		}
+	}
+	return conf, conf.Validate()
+}
+
+// ClientOptionsFromEnv creates ClientOptions from the STATSD_BUFFER and STATSD_DISABLED environment variables
+//
+// Invalid values are ignored, use LoadClientOptions to get an error for them
+func ClientOptionsFromEnv() ClientOptions {
+	options, _ := LoadClientOptions()
+	return options
+}
+
+// LoadClientOptions creates ClientOptions from environment variables and validates them
+//
+// Environment Variables:
+//  STATSD_BUFFER: the number of metrics to buffer before sending (default: 0)
+//  STATSD_DISABLED: send nothing (default: false)
+//
+// A *ConfError is returned for the first invalid value
+func LoadClientOptions() (ClientOptions, error) {
+	options := ClientOptions{}
+	if buffer := os.Getenv("STATSD_BUFFER"); buffer != "" {
+		n, err := strconv.Atoi(buffer)
+		if err != nil {
+			return options, &ConfError{"STATSD_BUFFER", buffer, "expecting a number"}
+		}
+		options.Buffer = n
+	}
+	if disabled := os.Getenv("STATSD_DISABLED"); disabled != "" {
+		b, err := strconv.ParseBool(disabled)
+		if err != nil {
+			return options, &ConfError{"STATSD_DISABLED", disabled, "expecting true or false"}
+		}
+		options.Disabled = b
+	}
+	return options, options.Validate()
+}
+
+// firstEnv returns the value of the first environment variable in names that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
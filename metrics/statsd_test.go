@@ -15,6 +15,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/DataDog/datadog-go/statsd"
 	"github.com/graze/golang-service/nettest"
 	"github.com/stretchr/testify/assert"
 )
@@ -114,3 +115,199 @@ func TestStatsdLoggingWithNamespaceAndTags(t *testing.T) {
 		assert.Equal(t, tc.expected, <-done, "test: %s", k)
 	}
 }
+
+func TestStatsdConfFromEnv(t *testing.T) {
+	os.Setenv("STATSD_HOST", "localhost")
+	os.Setenv("STATSD_PORT", "8125")
+	os.Setenv("STATSD_NAMESPACE", "app.live.")
+	os.Setenv("STATSD_TAGS", "env:live,version:1.0.2")
+	defer os.Unsetenv("STATSD_HOST")
+	defer os.Unsetenv("STATSD_PORT")
+	defer os.Unsetenv("STATSD_NAMESPACE")
+	defer os.Unsetenv("STATSD_TAGS")
+
+	expected := StatsdClientConf{
+		Host:      "localhost",
+		Port:      "8125",
+		Namespace: "app.live.",
+		Tags:      []string{"env:live", "version:1.0.2"},
+	}
+	assert.Equal(t, expected, StatsdConfFromEnv())
+}
+
+func setEnv(env map[string]string) func() {
+	for _, name := range []string{
+		"STATSD_HOST", "STATSD_PORT", "STATSD_NAMESPACE", "STATSD_TAGS", "STATSD_BUFFER", "STATSD_DISABLED",
+		"DD_AGENT_HOST", "DD_DOGSTATSD_PORT", "DD_ENV", "DD_SERVICE", "DD_VERSION",
+	} {
+		os.Unsetenv(name)
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name := range env {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoadStatsdConf(t *testing.T) {
+	cases := map[string]struct {
+		env      map[string]string
+		expected StatsdClientConf
+		field    string
+	}{
+		"statsd variables": {
+			map[string]string{"STATSD_HOST": "statsd", "STATSD_PORT": "9125", "STATSD_TAGS": "a:1, b:2,"},
+			StatsdClientConf{Host: "statsd", Port: "9125", Tags: []string{"a:1", "b:2"}},
+			"",
+		},
+		"datadog variables": {
+			map[string]string{"DD_AGENT_HOST": "agent", "DD_DOGSTATSD_PORT": "8126", "DD_ENV": "live", "DD_SERVICE": "api", "DD_VERSION": "1.2"},
+			StatsdClientConf{Host: "agent", Port: "8126", Tags: []string{"env:live", "service:api", "version:1.2"}},
+			"",
+		},
+		"statsd variables take precedence": {
+			map[string]string{"STATSD_HOST": "statsd", "DD_AGENT_HOST": "agent"},
+			StatsdClientConf{Host: "statsd", Port: DefaultStatsdPort},
+			"",
+		},
+		"no host": {
+			map[string]string{},
+			StatsdClientConf{Port: DefaultStatsdPort},
+			"Host",
+		},
+		"invalid port": {
+			map[string]string{"STATSD_HOST": "statsd", "STATSD_PORT": "99999"},
+			StatsdClientConf{Host: "statsd", Port: "99999"},
+			"Port",
+		},
+		"invalid tag": {
+			map[string]string{"STATSD_HOST": "statsd", "STATSD_TAGS": "a|b"},
+			StatsdClientConf{Host: "statsd", Port: DefaultStatsdPort, Tags: []string{"a|b"}},
+			"Tags",
+		},
+	}
+
+	for k, tc := range cases {
+		unset := setEnv(tc.env)
+		conf, err := LoadStatsdConf()
+		unset()
+
+		assert.Equal(t, tc.expected, conf, "test: %s", k)
+		if tc.field == "" {
+			assert.NoError(t, err, "test: %s", k)
+		} else if assert.IsType(t, &ConfError{}, err, "test: %s", k) {
+			assert.Equal(t, tc.field, err.(*ConfError).Field, "test: %s", k)
+		}
+	}
+}
+
+func TestLoadClientOptions(t *testing.T) {
+	cases := map[string]struct {
+		env      map[string]string
+		expected ClientOptions
+		field    string
+	}{
+		"defaults": {
+			map[string]string{},
+			ClientOptions{},
+			"",
+		},
+		"buffered": {
+			map[string]string{"STATSD_BUFFER": "10"},
+			ClientOptions{Buffer: 10},
+			"",
+		},
+		"disabled": {
+			map[string]string{"STATSD_DISABLED": "true"},
+			ClientOptions{Disabled: true},
+			"",
+		},
+		"invalid buffer": {
+			map[string]string{"STATSD_BUFFER": "lots"},
+			ClientOptions{},
+			"STATSD_BUFFER",
+		},
+		"negative buffer": {
+			map[string]string{"STATSD_BUFFER": "-1"},
+			ClientOptions{Buffer: -1},
+			"Buffer",
+		},
+		"invalid disabled": {
+			map[string]string{"STATSD_DISABLED": "maybe"},
+			ClientOptions{},
+			"STATSD_DISABLED",
+		},
+	}
+
+	for k, tc := range cases {
+		unset := setEnv(tc.env)
+		options, err := LoadClientOptions()
+		unset()
+
+		assert.Equal(t, tc.expected, options, "test: %s", k)
+		if tc.field == "" {
+			assert.NoError(t, err, "test: %s", k)
+		} else if assert.IsType(t, &ConfError{}, err, "test: %s", k) {
+			assert.Equal(t, tc.field, err.(*ConfError).Field, "test: %s", k)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(StatsdClientConf{Port: "8125"})
+	assert.Nil(t, client)
+	assert.IsType(t, &ConfError{}, err)
+
+	client, err = NewClient(StatsdClientConf{Host: "localhost", Port: "8125"})
+	assert.NoError(t, err)
+	assert.IsType(t, &statsd.Client{}, client)
+}
+
+func TestNewClientWith(t *testing.T) {
+	client, err := NewClientWith(StatsdClientConf{}, ClientOptions{Disabled: true})
+	assert.NoError(t, err)
+	assert.Equal(t, Noop{}, client)
+
+	statsdClient, err := GetStatsdWith(StatsdClientConf{}, ClientOptions{Disabled: true})
+	assert.NoError(t, err)
+	assert.Nil(t, statsdClient)
+
+	client, err = NewClientWith(StatsdClientConf{Host: "localhost", Port: "8125"}, ClientOptions{Buffer: -1})
+	assert.Nil(t, client)
+	assert.IsType(t, &ConfError{}, err)
+
+	client, err = NewClientWith(StatsdClientConf{Host: "localhost", Port: "8125"}, ClientOptions{Buffer: 5})
+	assert.NoError(t, err)
+	assert.IsType(t, &statsd.Client{}, client)
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	defer setEnv(map[string]string{"STATSD_DISABLED": "1"})()
+	client, err := NewClientFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, Noop{}, client)
+
+	os.Setenv("STATSD_DISABLED", "0")
+	_, err = NewClientFromEnv()
+	if assert.IsType(t, &ConfError{}, err) {
+		assert.Equal(t, "Host", err.(*ConfError).Field)
+	}
+
+	for name, value := range map[string]string{"STATSD_DISABLED": "maybe", "STATSD_BUFFER": "lots"} {
+		unset := setEnv(map[string]string{"STATSD_HOST": "localhost", name: value})
+		client, err := NewClientFromEnv()
+		assert.Nil(t, client, "test: %s", name)
+		if assert.IsType(t, &ConfError{}, err, "test: %s", name) {
+			assert.Equal(t, name, err.(*ConfError).Field, "test: %s", name)
+		}
+		statsdClient, err := GetStatsdFromEnv()
+		assert.Nil(t, statsdClient, "test: %s", name)
+		if assert.IsType(t, &ConfError{}, err, "test: %s", name) {
+			assert.Equal(t, name, err.(*ConfError).Field, "test: %s", name)
+		}
+		unset()
+	}
+}
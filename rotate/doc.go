@@ -0,0 +1,32 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+/*
+Package rotate provides a file that rotates itself, for writing logs to local files
+
+A File is rotated when it reaches MaxSize, at each multiple of Interval and when Rotate is called or a signal is
+received (see RotateOnSignal). Rotated files are renamed with the time they were rotated, optionally compressed, and
+removed once there are more than MaxBackups or they are older than MaxAge.
+
+Usage:
+    file := rotate.NewFile("/var/log/app/app.log")
+    file.MaxSize = 100 * 1024 * 1024
+    file.Interval = 24 * time.Hour
+    file.MaxBackups = 7
+    file.Compress = true
+    file.RotateOnSignal(syscall.SIGHUP)
+    defer file.Close()
+
+    log.SetOutput(file)
+
+    requests := rotate.NewFile("/var/log/app/healthd.log")
+    loggedRouter := handlers.HealthdIoHandler(requests, r)
+*/
+package rotate
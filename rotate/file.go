@@ -0,0 +1,371 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// backupTimeFormat is the timestamp added to the name of rotated files, it sorts in time order
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// ErrClosed is returned when writing to or rotating a File after it is closed
+var ErrClosed = errors.New("rotate: file is closed")
+
+// File is an io.WriteCloser that writes to Filename, rotating it when it gets too big, at fixed time boundaries and
+// when Rotate is called
+//
+// Rotated files are renamed to <name>-<timestamp><ext>, e.g. app-2016-10-28T10-00-00.000.log, and optionally
+// compressed. If a file was already rotated at the same time a counter is added, e.g. app-2016-10-28T10-00-00.000-1.log.
+// File is safe for concurrent use. The file is opened on the first write, appending to an existing file.
+type File struct {
+	// Filename is the file to write to. Its directory is created if it does not exist
+	Filename string
+	// MaxSize is the size in bytes at which the file is rotated, 0 for no limit
+	MaxSize int64
+	// Interval rotates the file at each multiple of Interval (UTC), e.g. time.Hour rotates on the hour. 0 disables
+	// time based rotation
+	Interval time.Duration
+	// MaxBackups is the number of rotated files to keep, 0 keeps every file
+	MaxBackups int
+	// MaxAge is how long rotated files are kept for, 0 keeps every file
+	MaxAge time.Duration
+	// Compress gzips each file after it is rotated
+	Compress bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	boundary time.Time
+	closed   bool
+	signals  []chan os.Signal
+	now      func() time.Time
+	// wg waits for rotated files to be compressed and removed
+	wg sync.WaitGroup
+	// signalWG waits for the goroutines rotating on signals
+	signalWG sync.WaitGroup
+}
+
+// Write writes p to the file, rotating it first if it would exceed MaxSize or a time boundary has passed
+//
+// ErrClosed is returned once the file is closed
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if (f.Interval > 0 && !f.clock().Before(f.boundary)) ||
+		(f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the file, renames it with the current time and opens a new file
+//
+// If the file has already been moved (for example by logrotate) the file is reopened
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+// RotateOnSignal rotates the file each time one of sigs is received until the file is closed. Defaults to SIGHUP
+//
+// Usage:
+//  file := rotate.NewFile("/var/log/app/app.log")
+//  file.RotateOnSignal()
+//  log.SetOutput(file)
+func (f *File) RotateOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		signal.Stop(ch)
+		return
+	}
+	f.signals = append(f.signals, ch)
+
+	f.signalWG.Add(1)
+	go func() {
+		defer f.signalWG.Done()
+		for range ch {
+			f.Rotate()
+		}
+	}()
+}
+
+// Close stops rotating on signals, closes the file and waits for rotated files to be compressed and removed
+//
+// A signal received while closing does not rotate the file, and the file is not reopened by later writes
+func (f *File) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	for _, ch := range f.signals {
+		signal.Stop(ch)
+		close(ch)
+	}
+	f.signals = nil
+
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.signalWG.Wait()
+	f.wg.Wait()
+	return err
+}
+
+// open opens Filename for appending, rotating an existing file first if it was last written before the current time
+// boundary
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Filename), 0755); err != nil {
+		return err
+	}
+
+	now := f.clock()
+	if f.Interval > 0 {
+		if info, err := os.Stat(f.Filename); err == nil && info.ModTime().Before(now.Truncate(f.Interval)) {
+			if err := f.backup(now); err != nil {
+				return err
+			}
+		}
+	}
+
+	file, err := os.OpenFile(f.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size = file, info.Size()
+	f.boundary = now.Truncate(f.Interval).Add(f.Interval)
+	return nil
+}
+
+// rotate closes the current file, moves it to a backup and opens a new file
+func (f *File) rotate() error {
+	if f.closed {
+		return ErrClosed
+	}
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	if err := f.backup(f.clock()); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// backup renames Filename to a backup name for now and starts compressing and removing old backups
+func (f *File) backup(now time.Time) error {
+	name := f.backupName(now)
+	if err := os.Rename(f.Filename, name); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if f.Compress {
+			CompressFile(name)
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// backupName returns an unused name for a file rotated at t
+//
+// A counter is added if a file was already rotated at t, compressed or not, so an earlier backup is never replaced
+func (f *File) backupName(t time.Time) string {
+	ext := filepath.Ext(f.Filename)
+	base := strings.TrimSuffix(f.Filename, ext) + "-" + t.UTC().Format(backupTimeFormat)
+	name := base + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = base + "-" + strconv.Itoa(i) + ext
+	}
+	return name
+}
+
+// exists returns true if there is a file called name
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// backupFile is a rotated file
+type backupFile struct {
+	name string
+	// rotated is when the file was rotated and n the counter added to its name
+	rotated time.Time
+	n       int
+}
+
+// byRotation sorts backup files from oldest to newest
+type byRotation []backupFile
+
+func (s byRotation) Len() int      { return len(s) }
+func (s byRotation) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRotation) Less(i, j int) bool {
+	if !s[i].rotated.Equal(s[j].rotated) {
+		return s[i].rotated.Before(s[j].rotated)
+	}
+	return s[i].n < s[j].n
+}
+
+// backups returns the rotated files sorted from oldest to newest
+func (f *File) backups() []backupFile {
+	ext := filepath.Ext(f.Filename)
+	prefix := filepath.Base(strings.TrimSuffix(f.Filename, ext)) + "-"
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(f.Filename), "*"))
+	if err != nil {
+		return nil
+	}
+
+	var backups byRotation
+	for _, name := range files {
+		base := strings.TrimSuffix(filepath.Base(name), ".gz")
+		if !strings.HasPrefix(base, prefix) || !strings.HasSuffix(base, ext) {
+			continue
+		}
+		if rotated, n, ok := parseBackup(strings.TrimSuffix(strings.TrimPrefix(base, prefix), ext)); ok {
+			backups = append(backups, backupFile{name, rotated, n})
+		}
+	}
+	sort.Sort(backups)
+	return backups
+}
+
+// parseBackup parses the timestamp and optional counter added to the name of a rotated file
+func parseBackup(s string) (time.Time, int, bool) {
+	ts, n := s, 0
+	if len(s) > len(backupTimeFormat) && s[len(backupTimeFormat)] == '-' {
+		var err error
+		if n, err = strconv.Atoi(s[len(backupTimeFormat)+1:]); err != nil || n < 1 {
+			return time.Time{}, 0, false
+		}
+		ts = s[:len(backupTimeFormat)]
+	}
+	t, err := time.Parse(backupTimeFormat, ts)
+	return t, n, err == nil
+}
+
+// prune removes rotated files past MaxBackups or older than MaxAge
+func (f *File) prune() {
+	if f.MaxBackups <= 0 && f.MaxAge <= 0 {
+		return
+	}
+	backups := f.backups()
+	cutoff := f.clock().Add(-f.MaxAge)
+	for i, b := range backups {
+		if (f.MaxBackups > 0 && len(backups)-i > f.MaxBackups) || (f.MaxAge > 0 && b.rotated.Before(cutoff)) {
+			os.Remove(b.name)
+		}
+	}
+}
+
+// clock returns the current time
+func (f *File) clock() time.Time {
+	if f.now != nil {
+		return f.now()
+	}
+	return time.Now()
+}
+
+// CompressFile gzips name to name.gz and removes name
+//
+// The compressed file is written to a temporary file first so that a partial file is never left with the .gz name
+func CompressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := name + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// NewFile creates a File writing to filename with no rotation limits set
+//
+// Usage:
+//  file := rotate.NewFile("/var/log/app/app.log")
+//  file.MaxSize = 100 * 1024 * 1024
+//  file.Interval = 24 * time.Hour
+//  file.MaxBackups = 7
+//  file.Compress = true
+//  file.RotateOnSignal()
+//  defer file.Close()
+//
+//  log.SetOutput(file)
+func NewFile(filename string) *File {
+	return &File{Filename: filename}
+}
@@ -0,0 +1,286 @@
+// This file is part of graze/golang-service
+//
+// Copyright (c) 2016 Nature Delivered Ltd. <https://www.graze.com>
+//
+// For the full copyright and license information, please view the LICENSE
+// file that was distributed with this source code.
+//
+// license: https://github.com/graze/golang-service/blob/master/LICENSE
+// link:    https://github.com/graze/golang-service
+
+package rotate
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tempDir creates a temporary directory and returns a function to remove it
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// files returns the names of the files in dir and their contents
+func files(t *testing.T, dir string) map[string]string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string, len(names))
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[filepath.Base(name)] = string(b)
+	}
+	return contents
+}
+
+func TestFileRotatesBySize(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	now := time.Date(2016, 10, 28, 10, 0, 0, 0, time.UTC)
+	file := NewFile(filepath.Join(dir, "app.log"))
+	file.MaxSize = 10
+	file.now = func() time.Time { return now }
+
+	file.Write([]byte("12345\n"))
+	file.Write([]byte("1234\n"))
+	now = now.Add(time.Second)
+	file.Write([]byte("123456789012345\n"))
+	assert.NoError(t, file.Close())
+
+	assert.Equal(t, map[string]string{
+		"app-2016-10-28T10-00-00.000.log": "12345\n",
+		"app-2016-10-28T10-00-01.000.log": "1234\n",
+		"app.log":                         "123456789012345\n",
+	}, files(t, dir))
+}
+
+func TestFileRotatesByTime(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	now := time.Date(2016, 10, 28, 10, 59, 0, 0, time.UTC)
+	file := NewFile(filepath.Join(dir, "app.log"))
+	file.Interval = time.Hour
+	file.now = func() time.Time { return now }
+
+	file.Write([]byte("one\n"))
+	now = now.Add(59 * time.Second)
+	file.Write([]byte("two\n"))
+	now = now.Add(time.Second)
+	file.Write([]byte("three\n"))
+	assert.NoError(t, file.Close())
+
+	assert.Equal(t, map[string]string{
+		"app-2016-10-28T11-00-00.000.log": "one\ntwo\n",
+		"app.log":                         "three\n",
+	}, files(t, dir))
+}
+
+func TestFileRotatesStaleFileOnOpen(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	name := filepath.Join(dir, "app.log")
+	ioutil.WriteFile(name, []byte("old\n"), 0644)
+	old := time.Date(2016, 10, 27, 23, 0, 0, 0, time.UTC)
+	os.Chtimes(name, old, old)
+
+	file := NewFile(name)
+	file.Interval = 24 * time.Hour
+	file.now = func() time.Time { return time.Date(2016, 10, 28, 10, 0, 0, 0, time.UTC) }
+	file.Write([]byte("new\n"))
+	assert.NoError(t, file.Close())
+
+	assert.Equal(t, map[string]string{
+		"app-2016-10-28T10-00-00.000.log": "old\n",
+		"app.log":                         "new\n",
+	}, files(t, dir))
+}
+
+func TestFileRetention(t *testing.T) {
+	cases := map[string]struct {
+		maxBackups int
+		maxAge     time.Duration
+		expected   []string
+	}{
+		"max backups":         {2, 0, []string{"app-2016-10-28T13-00-00.000.log", "app-2016-10-28T14-00-00.000.log", "app.log"}},
+		"max age":             {0, 90 * time.Minute, []string{"app-2016-10-28T13-00-00.000.log", "app-2016-10-28T14-00-00.000.log", "app.log"}},
+		"max backups and age": {1, 90 * time.Minute, []string{"app-2016-10-28T14-00-00.000.log", "app.log"}},
+		"keep all": {0, 0, []string{
+			"app-2016-10-28T11-00-00.000.log",
+			"app-2016-10-28T12-00-00.000.log",
+			"app-2016-10-28T13-00-00.000.log",
+			"app-2016-10-28T14-00-00.000.log",
+			"app.log",
+		}},
+	}
+
+	for k, tc := range cases {
+		dir, remove := tempDir(t)
+
+		now := time.Date(2016, 10, 28, 11, 0, 0, 0, time.UTC)
+		file := NewFile(filepath.Join(dir, "app.log"))
+		file.MaxBackups = tc.maxBackups
+		file.MaxAge = tc.maxAge
+		file.now = func() time.Time { return now }
+		ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte("not a backup\n"), 0644)
+
+		for i := 0; i < 4; i++ {
+			file.Write([]byte("line\n"))
+			file.Rotate()
+			file.wg.Wait()
+			now = now.Add(time.Hour)
+		}
+		file.Close()
+
+		var names []string
+		for name := range files(t, dir) {
+			if name != "other.log" {
+				names = append(names, name)
+			}
+		}
+		assert.Subset(t, tc.expected, names, "test: %s", k)
+		assert.Len(t, names, len(tc.expected), "test: %s", k)
+		remove()
+	}
+}
+
+func TestFileCompress(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	file := NewFile(filepath.Join(dir, "app.log"))
+	file.Compress = true
+	file.now = func() time.Time { return time.Date(2016, 10, 28, 10, 0, 0, 0, time.UTC) }
+	file.Write([]byte("compressed\n"))
+	assert.NoError(t, file.Rotate())
+	assert.NoError(t, file.Close())
+
+	contents := files(t, dir)
+	assert.Len(t, contents, 2)
+	assert.Equal(t, "", contents["app.log"])
+
+	in, err := os.Open(filepath.Join(dir, "app-2016-10-28T10-00-00.000.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, "compressed\n", string(b))
+}
+
+func TestFileReopensMovedFile(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	name := filepath.Join(dir, "app.log")
+	file := NewFile(name)
+	file.Write([]byte("before\n"))
+	os.Rename(name, filepath.Join(dir, "moved.log"))
+
+	assert.NoError(t, file.Rotate())
+	file.Write([]byte("after\n"))
+	assert.NoError(t, file.Close())
+
+	assert.Equal(t, map[string]string{
+		"moved.log": "before\n",
+		"app.log":   "after\n",
+	}, files(t, dir))
+}
+
+func TestFileRotateOnSignal(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	file := NewFile(filepath.Join(dir, "app.log"))
+	file.RotateOnSignal(syscall.SIGUSR1)
+	file.Write([]byte("before\n"))
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	for i := 0; i < 100 && len(files(t, dir)) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	file.Write([]byte("after\n"))
+	assert.NoError(t, file.Close())
+
+	contents := files(t, dir)
+	assert.Len(t, contents, 2)
+	assert.Equal(t, "after\n", contents["app.log"])
+}
+
+func TestFileCreatesDirectory(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	file := NewFile(filepath.Join(dir, "logs", "app.log"))
+	_, err := file.Write([]byte("line\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	assert.Equal(t, map[string]string{"app.log": "line\n"}, files(t, filepath.Join(dir, "logs")))
+}
+
+func TestFileRotatesTwiceInTheSameMillisecond(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	file := NewFile(filepath.Join(dir, "app.log"))
+	file.now = func() time.Time { return time.Date(2016, 10, 28, 10, 0, 0, 0, time.UTC) }
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		file.Write([]byte(line))
+		assert.NoError(t, file.Rotate())
+	}
+	file.Write([]byte("current\n"))
+	assert.NoError(t, file.Close())
+
+	assert.Equal(t, map[string]string{
+		"app-2016-10-28T10-00-00.000.log":   "first\n",
+		"app-2016-10-28T10-00-00.000-1.log": "second\n",
+		"app-2016-10-28T10-00-00.000-2.log": "third\n",
+		"app.log":                           "current\n",
+	}, files(t, dir))
+
+	backups := file.backups()
+	if assert.Len(t, backups, 3) {
+		assert.Equal(t, []int{0, 1, 2}, []int{backups[0].n, backups[1].n, backups[2].n}, "backups are sorted by rotation")
+	}
+}
+
+func TestFileClosed(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	file := NewFile(filepath.Join(dir, "app.log"))
+	file.RotateOnSignal(syscall.SIGUSR1)
+	file.Write([]byte("line\n"))
+
+	// a signal received while closing
+	file.mu.Lock()
+	file.signals[0] <- syscall.SIGUSR1
+	file.mu.Unlock()
+	assert.NoError(t, file.Close())
+
+	assert.Nil(t, file.file, "the file is not reopened by a rotation after it is closed")
+	_, err := file.Write([]byte("after\n"))
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, file.Rotate())
+}